@@ -0,0 +1,293 @@
+package chord
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	context "golang.org/x/net/context"
+)
+
+// BatchTransport can optionally be implemented by a Transport to look up the
+// successors of several keys with a single call.  Keys forwarded through a
+// transport without it are looked up one at a time.
+type BatchTransport interface {
+	// Returns the successors of each key, in the order of the keys
+	FindSuccessorsBatch(ctx context.Context, vn *Vnode, n int, keys [][]byte) ([][]*Vnode, error)
+}
+
+var errBatchUnsupported = errors.New("transport does not support batched lookups")
+
+// KeyGroup is a set of keys owned by the same vnode
+type KeyGroup struct {
+	Owner      *Vnode   // Vnode owning the keys, the first successor
+	Successors []*Vnode // Up to n successors of the keys, starting with Owner
+	Keys       [][]byte // Keys in the group, ordered by their hash
+}
+
+// LookupBatch does a lookup for up to N successors of many keys at once.  It
+// returns the keys grouped by the ID of the vnode owning them, as returned by
+// StringID.  The hashed keys are sorted so a single lookup answers every key
+// in the arcs covered by the successor list it returns, and the remaining
+// keys are forwarded together to each next hop.
+func (r *Ring) LookupBatch(keys [][]byte, n int) (map[string]*KeyGroup, error) {
+	return r.LookupBatchContext(context.Background(), keys, n)
+}
+
+// LookupBatchContext is the same as LookupBatch but the context is passed
+// through to every hop of the lookups.
+func (r *Ring) LookupBatchContext(ctx context.Context, keys [][]byte, n int) (map[string]*KeyGroup, error) {
+	// Ensure that n is sane
+	if n > r.config.NumSuccessors {
+		return nil, fmt.Errorf("cannot ask for more successors than NumSuccessors")
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("number of successors must be positive")
+	}
+
+	// Hash and sort the keys
+	batch := make([]batchKey, len(keys))
+	for i, key := range keys {
+		h := r.config.HashFunc()
+		h.Write(key)
+		batch[i] = batchKey{key: key, hash: h.Sum(nil)}
+	}
+	sort.Sort(batchKeys(batch))
+	hashes := make([][]byte, len(batch))
+	for i := range batch {
+		hashes[i] = batch[i].hash
+	}
+
+	// Resolve the successors of every hash
+	var res [][]*Vnode
+	var err error
+	if r.config.LookupMode == LookupIterative {
+		res, err = r.iterativeFindSuccessorsBatch(ctx, n, hashes)
+	} else {
+		res, err = r.recursiveFindSuccessorsBatch(ctx, n, hashes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the keys by owner
+	groups := make(map[string]*KeyGroup)
+	for i, succs := range res {
+		if len(succs) == 0 || succs[0] == nil {
+			return nil, fmt.Errorf("successor vnodes not found for %x", batch[i].hash)
+		}
+		id := succs[0].StringID()
+		g, ok := groups[id]
+		if !ok {
+			g = &KeyGroup{Owner: succs[0], Successors: succs}
+			groups[id] = g
+		}
+		g.Keys = append(g.Keys, batch[i].key)
+	}
+	return groups, nil
+}
+
+// Hands runs of sorted hashes sharing the nearest local vnode to that vnode
+func (r *Ring) recursiveFindSuccessorsBatch(ctx context.Context, n int, hashes [][]byte) ([][]*Vnode, error) {
+	out := make([][]*Vnode, 0, len(hashes))
+	for start := 0; start < len(hashes); {
+		nearest := r.nearestVnode(hashes[start])
+		end := start + 1
+		for end < len(hashes) && r.nearestVnode(hashes[end]) == nearest {
+			end++
+		}
+		res, err := nearest.FindSuccessorsBatch(ctx, n, hashes[start:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+		start = end
+	}
+	return out, nil
+}
+
+// Looks up the first unresolved hash iteratively and answers the following
+// hashes from the successor list returned, until every hash is resolved
+func (r *Ring) iterativeFindSuccessorsBatch(ctx context.Context, n int, hashes [][]byte) ([][]*Vnode, error) {
+	out := make([][]*Vnode, len(hashes))
+	for start := 0; start < len(hashes); {
+		succs, err := r.iterativeFindSuccessors(ctx, r.nearestVnode(hashes[start]), r.config.NumSuccessors, hashes[start])
+		if err != nil {
+			return nil, err
+		}
+		succs = dropNil(succs)
+		if len(succs) == 0 {
+			return nil, fmt.Errorf("successor vnodes not found")
+		}
+		start += resolveArcs(hashes[start], true, succs, n, hashes[start:], out[start:])
+	}
+	return out, nil
+}
+
+// FindSuccessorsBatch finds up to n successors of each key.  Keys in the arcs
+// covered by our successor list are answered directly.  The others are
+// forwarded in runs sharing the same closest preceding vnode, one call per
+// run, falling back to a regular lookup of each key if the call fails.
+func (vn *localVnode) FindSuccessorsBatch(ctx context.Context, n int, keys [][]byte) ([][]*Vnode, error) {
+	// Work off a snapshot of the routing state
+	vn.lock.RLock()
+	successors := make([]*Vnode, len(vn.successors))
+	copy(successors, vn.successors)
+	finger := make([]*Vnode, len(vn.finger))
+	copy(finger, vn.finger)
+	vn.lock.RUnlock()
+
+	succs := dropNil(successors)
+	if len(succs) == 0 {
+		return nil, errNoSuccessor
+	}
+
+	// Sort the keys, remembering where each came from
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Sort(&keyOrder{keys: keys, order: order})
+	sorted := make([][]byte, len(keys))
+	for i, idx := range order {
+		sorted[i] = keys[idx]
+	}
+
+	// Answer what we can from our successors, skipping over runs of keys
+	// that precede them
+	res := make([][]*Vnode, len(keys))
+	var pending []int
+	for i := 0; i < len(sorted); {
+		if num := resolveArcs(vn.Id, false, succs, n, sorted[i:], res[i:]); num > 0 {
+			i += num
+			continue
+		}
+		pending = append(pending, i)
+		i++
+	}
+
+	// Forward the remaining keys in runs sharing the next hop
+	bt, batched := vn.ring.transport.(BatchTransport)
+	for start := 0; start < len(pending); {
+		closest := vn.firstHop(sorted[pending[start]], successors, finger)
+		end := start + 1
+		for end < len(pending) && vn.firstHop(sorted[pending[end]], successors, finger) == closest {
+			end++
+		}
+		run := pending[start:end]
+		start = end
+
+		if closest != nil && batched {
+			runKeys := make([][]byte, len(run))
+			for i, idx := range run {
+				runKeys[i] = sorted[idx]
+			}
+			runRes, err := bt.FindSuccessorsBatch(ctx, closest, n, runKeys)
+			if err == nil && validBatch(runRes, len(run)) {
+				for i, idx := range run {
+					res[idx] = runRes[i]
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err == nil {
+				log.Printf("[ERR] Bad batched lookup from %s", closest.StringID())
+			} else if err != errBatchUnsupported {
+				log.Printf("[ERR] Failed to contact %s. Got %s", closest.StringID(), err)
+			}
+		}
+
+		// Look up each key on its own, with the usual failover
+		for _, idx := range run {
+			succ, err := vn.FindSuccessors(ctx, n, sorted[idx])
+			if err != nil {
+				return nil, err
+			}
+			res[idx] = trimSlice(succ)
+		}
+	}
+
+	// Put the results back in the order of the keys
+	out := make([][]*Vnode, len(keys))
+	for i, idx := range order {
+		out[idx] = res[i]
+	}
+	return out, nil
+}
+
+// Returns whether a remote batched lookup answered each of the num keys with
+// at least one successor
+func validBatch(res [][]*Vnode, num int) bool {
+	if len(res) != num {
+		return false
+	}
+	for _, succs := range res {
+		if len(succs) == 0 || succs[0] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the closest preceding vnode for the key from a routing snapshot
+func (vn *localVnode) firstHop(key []byte, successors, finger []*Vnode) *Vnode {
+	cp := closestPreceedingVnodeIterator{}
+	cp.initWith(vn, key, successors, finger)
+	return cp.Next()
+}
+
+// Answers the sorted keys that fall in the arcs covered by a successor list,
+// starting with keys[0].  The first arc runs from the from ID up to the first
+// successor, including from itself if incl is set.  Each following arc ends at
+// the next successor and is only used while n successors remain to answer
+// with.  Returns how many keys were resolved into out.
+func resolveArcs(from []byte, incl bool, succs []*Vnode, n int, keys [][]byte, out [][]*Vnode) int {
+	j := 0
+	prev := from
+	for i := 0; i < len(succs) && j < len(keys); {
+		if i > 0 && i+n > len(succs) {
+			break
+		}
+		key := keys[j]
+		inArc := betweenRightIncl(prev, succs[i].Id, key) ||
+			i == 0 && incl && bytes.Equal(key, from)
+		if !inArc {
+			// Keys are sorted, so move on to the next arc
+			prev = succs[i].Id
+			i++
+			continue
+		}
+		out[j] = firstN(succs[i:], n)
+		j++
+	}
+	return j
+}
+
+// A key of a batched lookup along with its hash
+type batchKey struct {
+	key  []byte
+	hash []byte
+}
+
+// batchKeys sorts keys by their hash
+type batchKeys []batchKey
+
+func (b batchKeys) Len() int           { return len(b) }
+func (b batchKeys) Less(i, j int) bool { return bytes.Compare(b[i].hash, b[j].hash) == -1 }
+func (b batchKeys) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// keyOrder sorts the indexes of keys by the key
+type keyOrder struct {
+	keys  [][]byte
+	order []int
+}
+
+func (k *keyOrder) Len() int { return len(k.order) }
+func (k *keyOrder) Less(i, j int) bool {
+	return bytes.Compare(k.keys[k.order[i]], k.keys[k.order[j]]) == -1
+}
+func (k *keyOrder) Swap(i, j int) { k.order[i], k.order[j] = k.order[j], k.order[i] }
@@ -0,0 +1,202 @@
+package chord
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	context "golang.org/x/net/context"
+)
+
+// Checks a batched lookup against a lookup of each key
+func checkLookupBatch(t *testing.T, r *Ring) {
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+
+	groups, err := r.LookupBatch(keys, 3)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+
+	found := 0
+	for id, g := range groups {
+		if g.Owner.StringID() != id || len(g.Successors) != 3 {
+			t.Fatalf("bad group %s", id)
+		}
+		for _, k := range g.Keys {
+			found++
+			_, _, exp, err := r.Lookup(3, k)
+			if err != nil {
+				t.Fatalf("unexpected err %s", err)
+			}
+			for i, succ := range exp {
+				if g.Successors[i].StringID() != succ.StringID() {
+					t.Fatalf("bad successor %d for %s", i, k)
+				}
+			}
+		}
+	}
+	if found != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), found)
+	}
+}
+
+func TestLookupBatch(t *testing.T) {
+	rings := makeRings(t, InitMLTransport(), 2, lookupMode(LookupRecursive))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	defer r2.Shutdown()
+	checkLookupBatch(t, r)
+	checkLookupBatch(t, r2)
+
+	// Ensure that n is sane
+	if _, err := r.LookupBatch([][]byte{[]byte("test")}, r.config.NumSuccessors+1); err == nil {
+		t.Fatalf("expected err!")
+	}
+
+	// No keys, no groups
+	groups, err := r.LookupBatch(nil, 1)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if len(groups) != 0 {
+		t.Fatalf("unexpected groups %v", groups)
+	}
+}
+
+func TestLookupBatchUnsupported(t *testing.T) {
+	rings := makeRings(t, &recursiveOnlyTrans{InitMLTransport()}, 2, lookupMode(LookupRecursive))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	defer r2.Shutdown()
+	checkLookupBatch(t, r)
+}
+
+// Answers batched lookups with empty successor lists
+type emptyBatchTrans struct {
+	*MultiLocalTrans
+}
+
+func (e *emptyBatchTrans) FindSuccessorsBatch(ctx context.Context, v *Vnode, n int, keys [][]byte) ([][]*Vnode, error) {
+	res := make([][]*Vnode, len(keys))
+	for i := range res {
+		if i%2 == 1 {
+			res[i] = []*Vnode{nil}
+		}
+	}
+	return res, nil
+}
+
+func TestLookupBatchEmpty(t *testing.T) {
+	// Short successor lists forward most keys to the other host
+	rings := makeRings(t, &emptyBatchTrans{InitMLTransport()}, 2, func(conf *Config) {
+		conf.NumSuccessors = 1
+	})
+	r := rings[0]
+	defer r.Shutdown()
+	defer rings[1].Shutdown()
+
+	// Bad answers fall back to a lookup of each key
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	groups, err := r.LookupBatch(keys, 1)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	found := 0
+	for id, g := range groups {
+		for _, k := range g.Keys {
+			found++
+			_, _, exp, err := r.Lookup(1, k)
+			if err != nil {
+				t.Fatalf("unexpected err %s", err)
+			}
+			if exp[0].StringID() != id {
+				t.Fatalf("bad owner for %s", k)
+			}
+		}
+	}
+	if found != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), found)
+	}
+}
+
+func TestLookupBatchIterative(t *testing.T) {
+	rings := makeRings(t, InitMLTransport(), 2, lookupMode(LookupIterative))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	defer r2.Shutdown()
+	checkLookupBatch(t, r)
+	checkLookupBatch(t, r2)
+}
+
+// Kill off a part of the ring and see what happens
+func TestVnodeFindSuccessorsBatchSomeDead(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	num := len(r.vnodes)
+	for i := 0; i < num; i++ {
+		r.vnodes[i].successors[0] = &r.vnodes[(i+1)%num].Vnode
+		r.vnodes[i].successors[1] = &r.vnodes[(i+2)%num].Vnode
+	}
+
+	// Kill 2 of the nodes
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[0].Vnode)
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[3].Vnode)
+
+	// Unsorted keys
+	var keys [][]byte
+	for i := 0; i < 50; i++ {
+		h := r.config.HashFunc()
+		h.Write([]byte(fmt.Sprintf("key%d", i)))
+		keys = append(keys, h.Sum(nil))
+	}
+
+	for i := 0; i < num; i++ {
+		vn := r.vnodes[i]
+		res, err := vn.FindSuccessorsBatch(context.Background(), 1, keys)
+		if err != nil {
+			t.Fatalf("(%d) unexpected err! %s", i, err)
+		}
+		if len(res) != len(keys) {
+			t.Fatalf("(%d) expected %d results, got %d", i, len(keys), len(res))
+		}
+		for j, key := range keys {
+			exp, err := vn.FindSuccessors(context.Background(), 1, key)
+			if err != nil {
+				t.Fatalf("(%d) unexpected err! %s", i, err)
+			}
+			if len(res[j]) != 1 || res[j][0] != exp[0] {
+				t.Fatalf("(%d) unexpected succ for %x! Exp: %s Got: %v", i, key, exp[0], res[j])
+			}
+		}
+	}
+}
+
+func TestResolveArcs(t *testing.T) {
+	succs := []*Vnode{{Id: []byte{10}}, {Id: []byte{20}}, {Id: []byte{30}}}
+	keys := [][]byte{{5}, {10}, {15}, {20}, {25}}
+	out := make([][]*Vnode, len(keys))
+
+	// The last arc needs 2 successors left to answer with
+	if num := resolveArcs([]byte{0}, false, succs, 2, keys, out); num != 4 {
+		t.Fatalf("expected 4 keys resolved, got %d", num)
+	}
+	for i, exp := range []int{0, 0, 1, 1} {
+		if out[i][0] != succs[exp] || len(out[i]) != 2 {
+			t.Fatalf("bad successors for key %d: %v", i, out[i])
+		}
+	}
+
+	// The start is only included if asked for
+	if num := resolveArcs([]byte{5}, false, succs, 1, keys, out); num != 0 {
+		t.Fatalf("expected no keys resolved, got %d", num)
+	}
+	if num := resolveArcs([]byte{5}, true, succs, 1, keys, out); num != 5 {
+		t.Fatalf("expected 5 keys resolved, got %d", num)
+	}
+}
@@ -8,31 +8,36 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"hash"
+	"sort"
+	"sync"
 	"time"
+
+	context "golang.org/x/net/context"
 )
 
-// Transport implements the methods needed for a Chord ring
+// Transport implements the methods needed for a Chord ring.  Every call takes
+// a context which implementations must honor for cancellation and deadlines.
 type Transport interface {
 	// Gets a list of the vnodes on the box
-	ListVnodes(string) ([]*Vnode, error)
+	ListVnodes(context.Context, string) ([]*Vnode, error)
 
 	// Ping a Vnode, check for liveness
-	Ping(*Vnode) (bool, error)
+	Ping(context.Context, *Vnode) (bool, error)
 
 	// Request a nodes predecessor
-	GetPredecessor(*Vnode) (*Vnode, error)
+	GetPredecessor(context.Context, *Vnode) (*Vnode, error)
 
 	// Notify our successor of ourselves
-	Notify(target, self *Vnode) ([]*Vnode, error)
+	Notify(ctx context.Context, target, self *Vnode) ([]*Vnode, error)
 
 	// Find a successor
-	FindSuccessors(*Vnode, int, []byte) ([]*Vnode, error)
+	FindSuccessors(context.Context, *Vnode, int, []byte) ([]*Vnode, error)
 
 	// Clears a predecessor if it matches a given vnode. Used to leave.
-	ClearPredecessor(target, self *Vnode) error
+	ClearPredecessor(ctx context.Context, target, self *Vnode) error
 
 	// Instructs a node to skip a given successor. Used to leave.
-	SkipSuccessor(target, self *Vnode) error
+	SkipSuccessor(ctx context.Context, target, self *Vnode) error
 
 	// Register for an RPC callbacks
 	Register(*Vnode, VnodeRPC)
@@ -40,14 +45,19 @@ type Transport interface {
 
 // VnodeRPC contains methods to invoke on the registered vnodes
 type VnodeRPC interface {
-	GetPredecessor() (*Vnode, error)
-	Notify(*Vnode) ([]*Vnode, error)
-	FindSuccessors(int, []byte) ([]*Vnode, error)
-	ClearPredecessor(*Vnode) error
-	SkipSuccessor(*Vnode) error
+	GetPredecessor(context.Context) (*Vnode, error)
+	Notify(context.Context, *Vnode) ([]*Vnode, error)
+	FindSuccessors(context.Context, int, []byte) ([]*Vnode, error)
+	ClearPredecessor(context.Context, *Vnode) error
+	SkipSuccessor(context.Context, *Vnode) error
+	ClosestPreceding(context.Context, int, []byte) ([]*Vnode, []*Vnode, error)
+	FindSuccessorsBatch(context.Context, int, [][]byte) ([][]*Vnode, error)
 }
 
-// Delegate to notify on ring events
+// Delegate to notify on ring events.  The methods are called one at a time
+// from a single go routine.  The ring waits for a Delegate that falls behind,
+// while the calls of the optional delegate interfaces are coalesced or dropped
+// instead.
 type Delegate interface {
 	NewPredecessor(local, remoteNew, remotePrev *Vnode)
 	Leaving(local, pred, succ *Vnode)
@@ -56,6 +66,17 @@ type Delegate interface {
 	Shutdown()
 }
 
+// SuccessorDelegate can optionally be implemented by a Delegate to be told
+// when the replica set of a local vnode changes.
+type SuccessorDelegate interface {
+	// The successor list changed from prev to succs.  The changes made by one
+	// stabilization round are reported together.
+	SuccessorsChanged(local *Vnode, prev, succs []*Vnode)
+	// A run of finger table entries now points at fingers.Vnode.  Prev is
+	// what the first of them pointed at before, nil if it was not set.
+	FingerChanged(local *Vnode, fingers FingerRange, prev *Vnode)
+}
+
 // Meta holds metadata for a node
 type Meta map[string][]byte
 
@@ -87,50 +108,105 @@ func (meta Meta) UnmarshalBinary(b []byte) error {
 
 // Config for Chord nodes
 type Config struct {
-	Hostname      string           // Local host name
-	Meta          Meta             // User defined metadata
-	NumVnodes     int              // Number of vnodes per physical node
-	HashFunc      func() hash.Hash `json:"-"` // Hash function to use
-	StabilizeMin  time.Duration    // Minimum stabilization time
-	StabilizeMax  time.Duration    // Maximum stabilization time
-	NumSuccessors int              // Number of successors to maintain
-	Delegate      Delegate         `json:"-"` // Invoked to handle ring events
-	hashBits      int              // Bit size of the hash function
+	Hostname          string           // Local host name
+	Meta              Meta             // User defined metadata
+	NumVnodes         int              // Number of vnodes per physical node
+	HashFunc          func() hash.Hash `json:"-"` // Hash function to use
+	StabilizeMin      time.Duration    // Minimum stabilization time
+	StabilizeMax      time.Duration    // Maximum stabilization time
+	NumSuccessors     int              // Number of successors to maintain
+	Delegate          Delegate         `json:"-"` // Invoked to handle ring events
+	Seeds             []string         // Hosts used to rebootstrap isolated vnodes
+	IDGenerator       IDGenerator      `json:"-"` // Assigns the vnode IDs, hashes the hostname if nil
+	LookupMode        LookupMode       // How lookups are routed, recursive by default
+	HopTimeout        time.Duration    // Bounds each hop of an iterative lookup, 0 for none
+	HandoffTimeout    time.Duration    // Bounds the handoff of all the leaving vnodes, 0 for none
+	PhiThreshold      float64          // Suspicion level declaring a host dead, 0 to declare it on the first failure
+	ProximityRouting  bool             // Prefer the lowest latency vnodes for fingers and lookup hops
+	AdaptiveStabilize bool             // Stabilize at StabilizeMin while the routing state changes, backing off to StabilizeMax
+	StableRounds      int              // Rounds the successor lists must stay unchanged for WaitStable
+	MembersRefresh    time.Duration    // Interval of the background refresh of Members, 0 to walk on every call
+	hashBits          int              // Bit size of the hash function
 }
 
-// Represents a local Vnode
+// Represents a local Vnode.  The routing state is read by RPC handlers while
+// the stabilize timer updates it, so every field below lock must only be
+// accessed while holding it.  The lock is never held across an RPC.
 type localVnode struct {
 	Vnode
 	ring        *Ring
+	index       int
+	lock        sync.RWMutex
 	successors  []*Vnode
 	finger      []*Vnode
 	lastFinger  int
 	predecessor *Vnode
+	owned       *Vnode // Predecessor our range starts at, kept when cleared
 	stabilized  time.Time
+	stats       StabilizeStats
+	churn       bool // Routing state changed since the last scheduling
+	succChanged bool // Successor list changed during the current round
+	isolated    bool
 	timer       *time.Timer
+	stopCh      chan bool
+}
+
+// FingerRange is a run of consecutive finger table entries pointing at the
+// same vnode.
+type FingerRange struct {
+	Start int    // Index of the first finger in the run
+	End   int    // Index of the last finger in the run, inclusive
+	Vnode *Vnode // Vnode the fingers point to
+}
+
+// VnodeInfo is a read-only snapshot of the routing state of a local vnode
+type VnodeInfo struct {
+	Vnode       Vnode          // Id, host and meta of the local vnode
+	Predecessor *Vnode         // Known predecessor, nil if unknown
+	Successors  []*Vnode       // Known successors, nearest first
+	Fingers     []FingerRange  // Populated finger table entries
+	LastFinger  int            // Index of the next finger to repair
+	Stabilized  time.Time      // Last completed stabilization
+	Stabilize   StabilizeStats // Stabilization interval and change counters
 }
 
 // Ring stores the state required for a Chord ring
 type Ring struct {
-	config     *Config
-	transport  Transport
-	vnodes     []*localVnode
-	delegateCh chan func()
-	shutdown   chan bool
+	config       *Config
+	transport    Transport
+	vnodeLock    sync.RWMutex // Guards vnodes
+	vnodes       []*localVnode
+	resizeLock   sync.Mutex      // Serializes adding, removing and stopping vnodes
+	events       eventBus        // Subscriptions to the ring events
+	detector     failureDetector // Heartbeats of the remote hosts
+	latency      latencyTracker  // Round trip times of the remote hosts
+	members      memberCache     // Last walk of the ring members
+	delegateLock sync.RWMutex    // Guards delegateSub
+	delegateSub  *subscriber
+	lock         sync.Mutex // Guards shutdown and state
+	shutdown     chan bool
+	state        RingState
+	stopping     bool          // Set once Leave or Shutdown started
+	stopped      chan struct{} // Closed once the ring is stopped
 }
 
 // DefaultConfig returns the default Ring configuration
 func DefaultConfig(hostname string) *Config {
 	return &Config{
-		Hostname:      hostname,
-		Meta:          make(Meta),
-		NumVnodes:     8,
-		HashFunc:      sha1.New, // sha1
-		StabilizeMin:  time.Duration(15 * time.Second),
-		StabilizeMax:  time.Duration(45 * time.Second),
-		NumSuccessors: 8,
-		Delegate:      nil,
-		hashBits:      160, // 160bit hash function for sha1
+		Hostname:          hostname,
+		Meta:              make(Meta),
+		NumVnodes:         8,
+		HashFunc:          sha1.New, // sha1
+		StabilizeMin:      time.Duration(15 * time.Second),
+		StabilizeMax:      time.Duration(45 * time.Second),
+		AdaptiveStabilize: true,
+		NumSuccessors:     8,
+		Delegate:          nil,
+		IDGenerator:       HostnameIDGenerator{},
+		HandoffTimeout:    defaultHandoffTimeout,
+		StableRounds:      3,
+		MembersRefresh:    time.Duration(time.Minute),
+		hashBits:          160, // 160bit hash function for sha1
 	}
 }
 
@@ -141,20 +217,29 @@ func Create(conf *Config, trans Transport) (*Ring, error) {
 
 	// Create and initialize a ring
 	ring := &Ring{}
-	ring.init(conf, trans)
+	if err := ring.init(conf, trans); err != nil {
+		return nil, err
+	}
 	ring.setLocalSuccessors()
 	ring.schedule()
+	ring.setState(StateActive)
 
 	return ring, nil
 }
 
 // Join an existing Chord ring
 func Join(conf *Config, trans Transport, existing string) (*Ring, error) {
+	return JoinContext(context.Background(), conf, trans, existing)
+}
+
+// JoinContext joins an existing Chord ring.  The context bounds the remote
+// calls made to locate the successors of the local vnodes.
+func JoinContext(ctx context.Context, conf *Config, trans Transport, existing string) (*Ring, error) {
 	// Initialize the hash bits
 	conf.hashBits = conf.HashFunc().Size() * 8
 
 	// Request a list of Vnodes from the remote host
-	hosts, err := trans.ListVnodes(existing)
+	hosts, err := trans.ListVnodes(ctx, existing)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +249,13 @@ func Join(conf *Config, trans Transport, existing string) (*Ring, error) {
 
 	// Create a ring
 	ring := &Ring{}
-	ring.init(conf, trans)
+	if err := ring.init(conf, trans); err != nil {
+		return nil, err
+	}
+	if err := ring.checkRemoteCollision(hosts); err != nil {
+		ring.deregisterVnodes()
+		return nil, err
+	}
 
 	// Acquire a live successor for each Vnode
 	for _, vn := range ring.vnodes {
@@ -172,71 +263,242 @@ func Join(conf *Config, trans Transport, existing string) (*Ring, error) {
 		nearest := nearestVnodeToKey(hosts, vn.Id)
 
 		// Query for a list of successors to this Vnode
-		succs, err := trans.FindSuccessors(nearest, conf.NumSuccessors, vn.Id)
+		succs, err := trans.FindSuccessors(ctx, nearest, conf.NumSuccessors, vn.Id)
 		if err != nil {
 			//return nil, fmt.Errorf("Failed to find successor for vnodes! Got %s", err)
+			ring.deregisterVnodes()
 			return nil, err
 		}
 		if succs == nil || len(succs) == 0 {
+			ring.deregisterVnodes()
 			return nil, fmt.Errorf("successor vnodes not found")
 		}
 
-		// Assign the successors
-		for idx, s := range succs {
-			vn.successors[idx] = s
+		// Refuse to take the ID of another vnode
+		if err := checkCollision(&vn.Vnode, succs); err != nil {
+			ring.deregisterVnodes()
+			return nil, err
 		}
-	}
 
-	// Start delegate handler
-	if ring.config.Delegate != nil {
-		go ring.delegateHandler()
-	}
-	// Do a fast stabilization, will schedule regular execution
-	for _, vn := range ring.vnodes {
-		vn.stabilize()
+		// Assign the successors
+		vn.setSuccessors(succs)
 	}
 
-	//ring.schedule()
-
+	ring.startJoined()
 	return ring, nil
 }
 
-// Leave a given Chord ring and shuts down the local vnodes
+// Leave a given Chord ring and shuts down the local vnodes.  Only an active
+// ring can leave.  Leaving a ring already leaving or stopped waits for it to
+// stop and returns a StateError.
 func (r *Ring) Leave() error {
+	if err := r.claimStop("leave", StateActive); err != nil {
+		return err
+	}
+	r.setState(StateLeaving)
+
 	// Shutdown the vnodes first to avoid further stabilization runs
 	r.stopVnodes()
 
-	// Instruct each vnode to leave
-	var err error
-	for _, vn := range r.vnodes {
+	// Hand the ranges over, then instruct each vnode to leave
+	vnodes := r.localVnodes()
+	err := handoffVnodes(vnodes)
+	for _, vn := range vnodes {
 		err = mergeErrors(err, vn.leave())
 	}
 
 	// Wait for the delegate callbacks to complete
-	r.stopDelegate()
+	r.finishStop()
 	return err
 }
 
 // Shutdown shuts down the local processes in a given Chord ring
-// Blocks until all the vnodes terminate.
-func (r *Ring) Shutdown() {
+// Blocks until all the vnodes terminate.  Shutting down a ring already
+// leaving or stopped waits for it to stop and returns a StateError.
+func (r *Ring) Shutdown() error {
+	if err := r.claimStop("shutdown", StateJoining, StateActive); err != nil {
+		return err
+	}
 	r.stopVnodes()
-	r.stopDelegate()
+	r.finishStop()
+	return nil
+}
+
+// AddVnodes creates n more local vnodes and joins them to the ring through the
+// existing ones.  The new vnodes take the lowest unused indexes, so they get
+// the same IDs as a ring created with that many more vnodes.  A
+// TokenIDGenerator only has Config.NumVnodes tokens, so with it the ring can
+// only grow back to that size.
+func (r *Ring) AddVnodes(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of vnodes to add must be positive")
+	}
+	r.resizeLock.Lock()
+	defer r.resizeLock.Unlock()
+	if r.shutdownCh() != nil {
+		return fmt.Errorf("ring is shutting down")
+	}
+
+	// Create the vnodes using the unused indexes
+	used := make(map[int]bool)
+	ids := make(map[string]bool)
+	for _, vn := range r.localVnodes() {
+		used[vn.index] = true
+		ids[vn.StringID()] = true
+	}
+	if isTokenGenerator(r.config.IDGenerator) {
+		free := 0
+		for idx := 0; idx < r.config.NumVnodes; idx++ {
+			if !used[idx] {
+				free++
+			}
+		}
+		if n > free {
+			return fmt.Errorf("cannot add %d vnodes, the token ID generator has %d of its %d tokens free",
+				n, free, r.config.NumVnodes)
+		}
+	}
+
+	added := make([]*localVnode, 0, n)
+	fail := func(err error) error {
+		for _, vn := range added {
+			r.deregister(vn)
+		}
+		return err
+	}
+	for idx := 0; len(added) < n; idx++ {
+		if used[idx] {
+			continue
+		}
+		vn := &localVnode{}
+		vn.ring = r
+		if err := vn.init(idx); err != nil {
+			return fail(err)
+		}
+		added = append(added, vn)
+		if ids[vn.StringID()] {
+			return fail(fmt.Errorf("local vnodes share ID %s", vn.StringID()))
+		}
+		ids[vn.StringID()] = true
+	}
+
+	// Acquire the successors of each new vnode through the existing ones
+	ctx := context.Background()
+	for _, vn := range added {
+		succs, err := r.nearestVnode(vn.Id).FindSuccessors(ctx, r.config.NumSuccessors, vn.Id)
+		if err == nil && knownVnodes(succs) == 0 {
+			err = fmt.Errorf("successor vnodes not found")
+		}
+		if err == nil {
+			err = checkCollision(&vn.Vnode, succs)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		vn.setSuccessors(succs)
+	}
+
+	// Make the vnodes visible and start stabilizing them
+	r.vnodeLock.Lock()
+	r.vnodes = append(r.vnodes, added...)
+	sort.Sort(r)
+	r.vnodeLock.Unlock()
+	for _, vn := range added {
+		vn.stabilize()
+	}
+	return nil
+}
+
+// RemoveVnodes gracefully removes n local vnodes from the ring, highest index
+// first.  Each vnode stops stabilizing, has its predecessor skip it and its
+// successor clear it, and is then deregistered from the transport.  At least
+// one local vnode must remain.
+func (r *Ring) RemoveVnodes(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of vnodes to remove must be positive")
+	}
+	r.resizeLock.Lock()
+	defer r.resizeLock.Unlock()
+	if r.shutdownCh() != nil {
+		return fmt.Errorf("ring is shutting down")
+	}
+
+	vnodes := r.localVnodes()
+	if n >= len(vnodes) {
+		return fmt.Errorf("cannot remove %d of %d vnodes", n, len(vnodes))
+	}
+
+	// Pick the vnodes with the highest indexes
+	indexes := make([]int, len(vnodes))
+	for i, vn := range vnodes {
+		indexes[i] = vn.index
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	lowest := indexes[n-1]
+
+	// Stop routing lookups through them
+	var kept, removed []*localVnode
+	for _, vn := range vnodes {
+		if vn.index >= lowest {
+			removed = append(removed, vn)
+		} else {
+			kept = append(kept, vn)
+		}
+	}
+	r.vnodeLock.Lock()
+	r.vnodes = kept
+	r.vnodeLock.Unlock()
+
+	// Hand the ranges over and leave the ring
+	for _, vn := range removed {
+		vn.stop()
+	}
+	err := handoffVnodes(removed)
+	for _, vn := range removed {
+		err = mergeErrors(err, vn.leave())
+		r.deregister(vn)
+	}
+	return err
+}
+
+// Vnodes returns a snapshot of the routing state of every local vnode, in ring
+// order.
+func (r *Ring) Vnodes() []*VnodeInfo {
+	vnodes := r.localVnodes()
+	infos := make([]*VnodeInfo, len(vnodes))
+	for i, vn := range vnodes {
+		infos[i] = vn.info()
+	}
+	return infos
 }
 
 // LookupHash does a lookup for up to N successors of a hash.  It returns the predecessor and up
 // to N successors. The hash size must match the hash function used when init'ing the ring.
 func (r *Ring) LookupHash(n int, hash []byte) (*Vnode, []*Vnode, error) {
+	return r.LookupHashContext(context.Background(), n, hash)
+}
+
+// LookupHashContext is the same as LookupHash but the context is passed
+// through to every hop of the lookup.
+func (r *Ring) LookupHashContext(ctx context.Context, n int, hash []byte) (*Vnode, []*Vnode, error) {
 	// Ensure that n is sane
 	if n > r.config.NumSuccessors {
 		return nil, nil, fmt.Errorf("cannot ask for more successors than NumSuccessors")
 	}
+	// Don't start a lookup nobody is waiting for
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 
 	// Find the nearest local vnode
 	nearest := r.nearestVnode(hash)
 	pred := nearest.Vnode
 	// Use the nearest node for the lookup
-	successors, err := nearest.FindSuccessors(n, hash)
+	trace := traceFrom(ctx)
+	hop := trace.begin(&pred, false)
+	start := time.Now()
+	successors, err := r.findSuccessors(ctx, nearest, n, hash)
+	trace.end(hop, start, err)
 	if err != nil {
 		return &pred, nil, err
 	}
@@ -251,11 +513,92 @@ func (r *Ring) LookupHash(n int, hash []byte) (*Vnode, []*Vnode, error) {
 // Lookup does a lookup for up to N successors on the hash of a key.  It returns the hash of the key used to
 // perform the lookup, the closest vnode and up to N successors.
 func (r *Ring) Lookup(n int, key []byte) ([]byte, *Vnode, []*Vnode, error) {
+	return r.LookupContext(context.Background(), n, key)
+}
+
+// LookupContext is the same as Lookup but the context is passed through to
+// every hop of the lookup.
+func (r *Ring) LookupContext(ctx context.Context, n int, key []byte) ([]byte, *Vnode, []*Vnode, error) {
 	// Hash the key
 	h := r.config.HashFunc()
 	h.Write(key)
 	kh := h.Sum(nil)
 
-	nearest, succs, err := r.LookupHash(n, kh)
+	nearest, succs, err := r.LookupHashContext(ctx, n, kh)
 	return kh, nearest, succs, err
 }
+
+// LookupN returns up to n distinct vnodes following the hash of a key, walking
+// around the ring past the successor lists as needed.  Fewer than n vnodes are
+// returned if the ring has fewer.  It returns the hash of the key along with
+// the vnodes.
+func (r *Ring) LookupN(n int, key []byte) ([]byte, []*Vnode, error) {
+	return r.LookupNContext(context.Background(), n, key)
+}
+
+// LookupNContext is the same as LookupN but the context is passed through to
+// every hop of the walk.
+func (r *Ring) LookupNContext(ctx context.Context, n int, key []byte) ([]byte, []*Vnode, error) {
+	// Hash the key
+	h := r.config.HashFunc()
+	h.Write(key)
+	kh := h.Sum(nil)
+
+	vnodes, err := r.lookupHashN(ctx, n, kh)
+	return kh, vnodes, err
+}
+
+// Collects up to n distinct vnodes following the hash.  Each step asks the
+// last vnode found for the successors past its own ID, falling back to a
+// regular lookup if it fails.  The walk ends once a step finds no new vnodes,
+// meaning it went all the way around the ring.
+func (r *Ring) lookupHashN(ctx context.Context, n int, hash []byte) ([]*Vnode, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of vnodes must be positive")
+	}
+
+	seen := make(map[string]bool, n)
+	out := make([]*Vnode, 0, n)
+	var last *Vnode
+	key := hash
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Get the next batch of successors
+		var succs []*Vnode
+		var err error
+		if last != nil {
+			succs, err = r.transport.FindSuccessors(ctx, last, r.config.NumSuccessors, key)
+		}
+		if last == nil || err != nil {
+			succs, err = r.findSuccessors(ctx, r.nearestVnode(key), r.config.NumSuccessors, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Collect the new vnodes in ring order
+		added := 0
+		for _, s := range succs {
+			if s == nil {
+				break
+			}
+			if seen[s.StringID()] {
+				continue
+			}
+			seen[s.StringID()] = true
+			out = append(out, s)
+			added++
+			last = s
+			if len(out) == n {
+				return out, nil
+			}
+		}
+		if added == 0 {
+			return out, nil
+		}
+		key = powerOffset(last.Id, 0, r.config.hashBits)
+	}
+}
@@ -1,13 +1,20 @@
 package chord
 
 import (
+	"bytes"
+	"fmt"
 	"runtime"
+	"sort"
+	"sync"
 	"testing"
 	"time"
+
+	context "golang.org/x/net/context"
 )
 
 type MultiLocalTrans struct {
 	remote Transport
+	lock   sync.RWMutex
 	hosts  map[string]*LocalTransport
 }
 
@@ -19,72 +26,105 @@ func InitMLTransport() *MultiLocalTrans {
 	return ml
 }
 
-func (ml *MultiLocalTrans) ListVnodes(host string) ([]*Vnode, error) {
-	if local, ok := ml.hosts[host]; ok {
-		return local.ListVnodes(host)
+func (ml *MultiLocalTrans) get(host string) (*LocalTransport, bool) {
+	ml.lock.RLock()
+	defer ml.lock.RUnlock()
+	local, ok := ml.hosts[host]
+	return local, ok
+}
+
+func (ml *MultiLocalTrans) ListVnodes(ctx context.Context, host string) ([]*Vnode, error) {
+	if local, ok := ml.get(host); ok {
+		return local.ListVnodes(ctx, host)
 	}
-	return ml.remote.ListVnodes(host)
+	return ml.remote.ListVnodes(ctx, host)
 }
 
 // Ping a Vnode, check for liveness
-func (ml *MultiLocalTrans) Ping(v *Vnode) (bool, error) {
-	if local, ok := ml.hosts[v.Host]; ok {
-		return local.Ping(v)
+func (ml *MultiLocalTrans) Ping(ctx context.Context, v *Vnode) (bool, error) {
+	if local, ok := ml.get(v.Host); ok {
+		return local.Ping(ctx, v)
 	}
-	return ml.remote.Ping(v)
+	return ml.remote.Ping(ctx, v)
 }
 
 // Request a nodes predecessor
-func (ml *MultiLocalTrans) GetPredecessor(v *Vnode) (*Vnode, error) {
-	if local, ok := ml.hosts[v.Host]; ok {
-		return local.GetPredecessor(v)
+func (ml *MultiLocalTrans) GetPredecessor(ctx context.Context, v *Vnode) (*Vnode, error) {
+	if local, ok := ml.get(v.Host); ok {
+		return local.GetPredecessor(ctx, v)
 	}
-	return ml.remote.GetPredecessor(v)
+	return ml.remote.GetPredecessor(ctx, v)
 }
 
 // Notify our successor of ourselves
-func (ml *MultiLocalTrans) Notify(target, self *Vnode) ([]*Vnode, error) {
-	if local, ok := ml.hosts[target.Host]; ok {
-		return local.Notify(target, self)
+func (ml *MultiLocalTrans) Notify(ctx context.Context, target, self *Vnode) ([]*Vnode, error) {
+	if local, ok := ml.get(target.Host); ok {
+		return local.Notify(ctx, target, self)
 	}
-	return ml.remote.Notify(target, self)
+	return ml.remote.Notify(ctx, target, self)
 }
 
 // Find a successor
-func (ml *MultiLocalTrans) FindSuccessors(v *Vnode, n int, k []byte) ([]*Vnode, error) {
-	if local, ok := ml.hosts[v.Host]; ok {
-		return local.FindSuccessors(v, n, k)
+func (ml *MultiLocalTrans) FindSuccessors(ctx context.Context, v *Vnode, n int, k []byte) ([]*Vnode, error) {
+	if local, ok := ml.get(v.Host); ok {
+		return local.FindSuccessors(ctx, v, n, k)
 	}
-	return ml.remote.FindSuccessors(v, n, k)
+	return ml.remote.FindSuccessors(ctx, v, n, k)
 }
 
 // Clears a predecessor if it matches a given vnode. Used to leave.
-func (ml *MultiLocalTrans) ClearPredecessor(target, self *Vnode) error {
-	if local, ok := ml.hosts[target.Host]; ok {
-		return local.ClearPredecessor(target, self)
+func (ml *MultiLocalTrans) ClearPredecessor(ctx context.Context, target, self *Vnode) error {
+	if local, ok := ml.get(target.Host); ok {
+		return local.ClearPredecessor(ctx, target, self)
 	}
-	return ml.remote.ClearPredecessor(target, self)
+	return ml.remote.ClearPredecessor(ctx, target, self)
 }
 
 // Instructs a node to skip a given successor. Used to leave.
-func (ml *MultiLocalTrans) SkipSuccessor(target, self *Vnode) error {
-	if local, ok := ml.hosts[target.Host]; ok {
-		return local.SkipSuccessor(target, self)
+func (ml *MultiLocalTrans) SkipSuccessor(ctx context.Context, target, self *Vnode) error {
+	if local, ok := ml.get(target.Host); ok {
+		return local.SkipSuccessor(ctx, target, self)
+	}
+	return ml.remote.SkipSuccessor(ctx, target, self)
+}
+
+// Get the next hops of an iterative lookup
+func (ml *MultiLocalTrans) ClosestPreceding(ctx context.Context, v *Vnode, n int, k []byte) ([]*Vnode, []*Vnode, error) {
+	if local, ok := ml.get(v.Host); ok {
+		return local.ClosestPreceding(ctx, v, n, k)
+	}
+	return nil, nil, errIterativeUnsupported
+}
+
+// Find the successors of several keys
+func (ml *MultiLocalTrans) FindSuccessorsBatch(ctx context.Context, v *Vnode, n int, keys [][]byte) ([][]*Vnode, error) {
+	if local, ok := ml.get(v.Host); ok {
+		return local.FindSuccessorsBatch(ctx, v, n, keys)
 	}
-	return ml.remote.SkipSuccessor(target, self)
+	return nil, errBatchUnsupported
 }
 
 func (ml *MultiLocalTrans) Register(v *Vnode, o VnodeRPC) {
+	ml.lock.Lock()
 	local, ok := ml.hosts[v.Host]
 	if !ok {
 		local = InitLocalTransport(nil).(*LocalTransport)
 		ml.hosts[v.Host] = local
 	}
+	ml.lock.Unlock()
 	local.Register(v, o)
 }
 
-func (ml *MultiLocalTrans) Deregister(host string) {
+func (ml *MultiLocalTrans) Deregister(v *Vnode) {
+	if local, ok := ml.get(v.Host); ok {
+		local.Deregister(v)
+	}
+}
+
+func (ml *MultiLocalTrans) DeregisterHost(host string) {
+	ml.lock.Lock()
 	delete(ml.hosts, host)
+	ml.lock.Unlock()
 }
 
 func TestDefaultConfig(t *testing.T) {
@@ -156,6 +196,7 @@ func TestJoin(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to join local node! Got %s", err)
 	}
+	waitStable(t, r, r2)
 
 	// Shutdown
 	r.Shutdown()
@@ -194,21 +235,20 @@ func TestLeave(t *testing.T) {
 	}
 
 	// Wait for some stabilization
-	<-time.After(100 * time.Millisecond)
+	waitStable(t, r, r2)
 
 	// Node 1 should leave
 	r.Leave()
-	ml.Deregister("test")
+	ml.DeregisterHost("test")
 
 	// Wait for stabilization
-	<-time.After(100 * time.Millisecond)
+	waitStable(t, r2)
 
 	// Verify r2 ring is still in tact
 	num := len(r2.vnodes)
 	for idx, vn := range r2.vnodes {
-		if vn.successors[0] != &r2.vnodes[(idx+1)%num].Vnode {
-			t.Fatalf("bad successor! Got:%s:%s", vn.successors[0].Host,
-				vn.successors[0])
+		if succ := vn.successor(); succ != &r2.vnodes[(idx+1)%num].Vnode {
+			t.Fatalf("bad successor! Got:%s:%s", succ.Host, succ)
 		}
 	}
 }
@@ -250,7 +290,7 @@ func TestLookup(t *testing.T) {
 	}
 
 	// Wait for some stabilization
-	<-time.After(100 * time.Millisecond)
+	waitStable(t, r, r2)
 
 	// Try key lookup
 	keys := [][]byte{[]byte("test"), []byte("foo"), []byte("bar")}
@@ -281,3 +321,276 @@ func TestLookup(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupContextCanceled(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err = r.LookupContext(ctx, 3, []byte("test")); err != context.Canceled {
+		t.Fatalf("expected canceled err. Got %v", err)
+	}
+}
+
+func TestRingVnodes(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Wait for some stabilization
+	waitStable(t, r)
+
+	infos := r.Vnodes()
+	if len(infos) != conf.NumVnodes {
+		t.Fatalf("bad number of vnodes: %d", len(infos))
+	}
+	for idx, info := range infos {
+		next := infos[(idx+1)%len(infos)]
+		prev := infos[(idx+len(infos)-1)%len(infos)]
+		if len(info.Successors) == 0 || info.Successors[0].StringID() != next.Vnode.StringID() {
+			t.Fatalf("bad successor for %d", idx)
+		}
+		if info.Predecessor == nil || info.Predecessor.StringID() != prev.Vnode.StringID() {
+			t.Fatalf("bad predecessor for %d", idx)
+		}
+		if info.Stabilized.IsZero() {
+			t.Fatalf("vnode %d never stabilized", idx)
+		}
+		if len(info.Fingers) == 0 || info.Fingers[0].Start != 0 {
+			t.Fatalf("bad finger table for %d: %v", idx, info.Fingers)
+		}
+	}
+}
+
+// Checks that the successor list of every vnode across the rings holds the
+// following vnodes in ID order
+func checkRingOrder(rings ...*Ring) error {
+	var all []*Vnode
+	for _, r := range rings {
+		for _, info := range r.Vnodes() {
+			vn := info.Vnode
+			all = append(all, &vn)
+		}
+	}
+	sort.Sort(vnodeSlice(all))
+
+	for _, r := range rings {
+		for _, info := range r.Vnodes() {
+			idx := sort.Search(len(all), func(i int) bool {
+				return bytes.Compare(all[i].Id, info.Vnode.Id) >= 0
+			})
+			num := min(r.config.NumSuccessors, len(all)-1)
+			if len(info.Successors) != num {
+				return fmt.Errorf("bad successor count for %s", info.Vnode.StringID())
+			}
+			for i, succ := range info.Successors {
+				if next := all[(idx+i+1)%len(all)]; succ.StringID() != next.StringID() {
+					return fmt.Errorf("bad successor %d for %s", i, info.Vnode.StringID())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Polls checkRingOrder until it passes or five seconds pass
+func waitRingOrder(t *testing.T, rings ...*Ring) {
+	var err error
+	for i := 0; i < 500; i++ {
+		if err = checkRingOrder(rings...); err == nil {
+			return
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	t.Fatalf("ring did not stabilize: %s", err)
+}
+
+// Waits up to five seconds for every ring to be stable
+// Creates a ring of hosts named test, test2, test3 and so on, joined through
+// the first one, and waits for it to stabilize.  Setup adjusts the config of
+// each host, it may be nil.
+func makeRings(t *testing.T, trans Transport, hosts int, setup func(conf *Config)) []*Ring {
+	var rings []*Ring
+	for i := 0; i < hosts; i++ {
+		conf := fastConf()
+		if i > 0 {
+			conf.Hostname = fmt.Sprintf("test%d", i+1)
+		}
+		if setup != nil {
+			setup(conf)
+		}
+		var (
+			r   *Ring
+			err error
+		)
+		if i == 0 {
+			r, err = Create(conf, trans)
+		} else {
+			r, err = Join(conf, trans, "test")
+		}
+		if err != nil {
+			t.Fatalf("failed to start %s! Got %s", conf.Hostname, err)
+		}
+		rings = append(rings, r)
+	}
+	waitStable(t, rings...)
+	return rings
+}
+
+func waitStable(t *testing.T, rings ...*Ring) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, r := range rings {
+		if err := r.WaitStable(ctx); err != nil {
+			t.Fatalf("ring did not stabilize: %s", err)
+		}
+	}
+}
+
+func TestRingAddRemoveVnodes(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Create a second ring
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	// Grow the second ring
+	if err := r2.AddVnodes(4); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if n := len(r2.Vnodes()); n != 12 {
+		t.Fatalf("bad number of vnodes: %d", n)
+	}
+	waitRingOrder(t, r, r2)
+
+	// The added vnodes should match a ring created with 12 vnodes
+	vn := &localVnode{}
+	vn.ring = r2
+	vn.Host = conf2.Hostname
+	vn.genId(11)
+	if alive, _ := r.transport.Ping(context.Background(), &vn.Vnode); !alive {
+		t.Fatalf("vnode 11 not reachable")
+	}
+
+	// Shrink it below the original size
+	if err := r2.RemoveVnodes(6); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	infos := r2.Vnodes()
+	if len(infos) != 6 {
+		t.Fatalf("bad number of vnodes: %d", len(infos))
+	}
+	if alive, _ := r.transport.Ping(context.Background(), &vn.Vnode); alive {
+		t.Fatalf("removed vnode still reachable")
+	}
+	waitRingOrder(t, r, r2)
+
+	// The remaining vnodes are the lowest indexes
+	for _, info := range infos {
+		found := false
+		for idx := 0; idx < 6; idx++ {
+			vn.genId(idx)
+			if bytes.Equal(vn.Id, info.Vnode.Id) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("unexpected vnode left: %s", info.Vnode.StringID())
+		}
+	}
+
+	// Can't remove every vnode
+	if err := r2.RemoveVnodes(6); err == nil {
+		t.Fatalf("expected err!")
+	}
+}
+
+func TestLookupN(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Create a second ring
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	if _, _, err := r.LookupN(0, []byte("test")); err == nil {
+		t.Fatalf("expected err!")
+	}
+
+	// More vnodes than the successor lists hold
+	_, _, succs, err := r.Lookup(1, []byte("test"))
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	kh, vnodes, err := r2.LookupN(12, []byte("test"))
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if kh == nil || len(vnodes) != 12 {
+		t.Fatalf("bad result len %d", len(vnodes))
+	}
+	if vnodes[0].StringID() != succs[0].StringID() {
+		t.Fatalf("results differ!")
+	}
+	seen := make(map[string]bool)
+	for _, vn := range vnodes {
+		if seen[vn.StringID()] {
+			t.Fatalf("duplicate vnode %s", vn.StringID())
+		}
+		seen[vn.StringID()] = true
+	}
+
+	// Stop after going around the ring
+	_, vnodes, err = r.LookupN(100, []byte("test"))
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if len(vnodes) != 16 {
+		t.Fatalf("bad result len %d", len(vnodes))
+	}
+}
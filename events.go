@@ -0,0 +1,411 @@
+package chord
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened on the ring
+type EventType int
+
+const (
+	// EventNewPredecessor means a local vnode has a new predecessor, Remote.
+	// Prev is the predecessor it replaced, nil if there was none.
+	EventNewPredecessor EventType = iota
+	// EventPredecessorLeaving means the predecessor of a local vnode, Remote,
+	// is leaving the ring
+	EventPredecessorLeaving
+	// EventNewSuccessor means a local vnode has a new immediate successor,
+	// Remote.  Prev is the successor it replaced, nil if there was none.
+	EventNewSuccessor
+	// EventSuccessorsChanged means the successor list of a local vnode changed
+	// from PrevSuccessors to Successors
+	EventSuccessorsChanged
+	// EventSuccessorLeaving means the successor of a local vnode, Remote, is
+	// leaving the ring
+	EventSuccessorLeaving
+	// EventFingerChanged means the Finger entries of a local vnode now point at
+	// Remote.  Prev is what the first of them pointed at before.
+	EventFingerChanged
+	// EventLeaving means a local vnode is leaving the ring.  Prev is its
+	// predecessor and Remote its successor.
+	EventLeaving
+	// EventStabilized means a local vnode completed a stabilization round
+	EventStabilized
+	// EventRangeGained means a local vnode took over Range from Prev
+	EventRangeGained
+	// EventRangeLost means a local vnode handed Range over to Remote
+	EventRangeLost
+	// EventIsolated means a local vnode lost all its successors
+	EventIsolated
+	// EventRecovered means an isolated local vnode found its way back into
+	// the ring through Source, with the given Successors
+	EventRecovered
+	// EventStateChanged means the ring moved from the lifecycle state
+	// PrevState to State.  It has no Local vnode.
+	EventStateChanged
+	// EventShutdown means the ring is shut down.  It is the last event sent
+	// and has no Local vnode.
+	EventShutdown
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNewPredecessor:
+		return "new-predecessor"
+	case EventPredecessorLeaving:
+		return "predecessor-leaving"
+	case EventNewSuccessor:
+		return "new-successor"
+	case EventSuccessorsChanged:
+		return "successors-changed"
+	case EventSuccessorLeaving:
+		return "successor-leaving"
+	case EventFingerChanged:
+		return "finger-changed"
+	case EventLeaving:
+		return "leaving"
+	case EventStabilized:
+		return "stabilized"
+	case EventRangeGained:
+		return "range-gained"
+	case EventRangeLost:
+		return "range-lost"
+	case EventIsolated:
+		return "isolated"
+	case EventRecovered:
+		return "recovered"
+	case EventStateChanged:
+		return "state-changed"
+	case EventShutdown:
+		return "shutdown"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is something that happened to a local vnode.  Which of the fields are
+// set depends on the type.
+type Event struct {
+	Type           EventType
+	Time           time.Time      // When the event was published
+	Local          *Vnode         // Local vnode the event happened to
+	Remote         *Vnode         // Vnode the event is about
+	Prev           *Vnode         // Vnode replaced by Remote
+	Range          *KeyRange      // Range gained or lost
+	Finger         *FingerRange   // Finger entries changed
+	Source         RecoverySource // Where an isolated vnode recovered from
+	Successors     []*Vnode       // Successor list after the event
+	PrevSuccessors []*Vnode       // Successor list before the event
+	State          RingState      // Lifecycle state after the event
+	PrevState      RingState      // Lifecycle state before the event
+
+	fn func() // Function to run on the delegate handler instead
+}
+
+// OverflowPolicy selects what happens when the buffer of a subscriber is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered event to make room
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowBlock makes the publisher wait for room.  Events are published
+	// from the RPC handlers and stabilization of the vnodes, so a slow
+	// subscriber slows down the ring.
+	OverflowBlock
+	// OverflowCoalesce replaces a buffered event of the same type, vnode and
+	// finger with the new one, and otherwise discards the oldest event.  The
+	// replacement keeps the Prev or PrevSuccessors of the buffered event, and
+	// both are dropped if that undoes the change.  Range and state change
+	// events describe a change rather than a state and are never replaced.
+	OverflowCoalesce
+)
+
+// Default number of events buffered for a subscriber
+const defaultEventBuffer = 32
+
+// EventFilter selects the events sent to a subscriber and how they are
+// buffered
+type EventFilter struct {
+	Types    []EventType    // Types of events to send, all if empty
+	Buffer   int            // Number of events buffered, 32 if not set
+	Overflow OverflowPolicy // What to do when the buffer is full
+}
+
+// Subscribe returns a channel receiving the ring events matching the filter
+// and a function to cancel the subscription.  Every subscriber has its own
+// buffer.  The channel is closed once cancelled, or after EventShutdown has
+// been received when the ring is shut down or left.
+func (r *Ring) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	s := r.events.subscribe(filter)
+	return s.out, func() {
+		s.cancel()
+		r.events.unsubscribe(s)
+	}
+}
+
+// Sends an event to every matching subscriber
+func (r *Ring) publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	r.events.publish(ev)
+}
+
+// eventBus fans events out to the subscribers
+type eventBus struct {
+	lock   sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// Adds a subscriber.  Subscribing to a closed bus returns a closed channel.
+func (b *eventBus) subscribe(filter EventFilter) *subscriber {
+	return b.add(newSubscriber(filter))
+}
+
+// Adds a subscriber created by newSubscriber and starts feeding its channel
+func (b *eventBus) add(s *subscriber) *subscriber {
+	go s.run()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		s.close()
+		return s
+	}
+	if b.subs == nil {
+		b.subs = make(map[*subscriber]struct{})
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Removes a subscriber
+func (b *eventBus) unsubscribe(s *subscriber) {
+	b.lock.Lock()
+	delete(b.subs, s)
+	b.lock.Unlock()
+}
+
+// Queues the event for the matching subscribers.  The lock is not held while
+// queueing, so a blocked subscriber can still be cancelled.
+func (b *eventBus) publish(ev Event) {
+	b.lock.RLock()
+	subs := make([]*subscriber, 0, len(b.subs))
+	for s := range b.subs {
+		if s.matches(&ev) {
+			subs = append(subs, s)
+		}
+	}
+	b.lock.RUnlock()
+
+	for _, s := range subs {
+		s.push(ev)
+	}
+}
+
+// Closes every subscriber once it has received the events queued so far
+func (b *eventBus) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		s.close()
+	}
+	b.subs = nil
+}
+
+// subscriber buffers the events for one subscription and feeds them to its
+// channel from a go routine
+type subscriber struct {
+	filter   EventFilter
+	types    map[EventType]bool
+	blocking map[EventType]bool // Types waiting for room whatever the policy
+	out      chan Event
+	done     chan struct{} // Closed when cancelled
+	once     sync.Once
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool // No more events are queued
+}
+
+func newSubscriber(filter EventFilter) *subscriber {
+	if filter.Buffer <= 0 {
+		filter.Buffer = defaultEventBuffer
+	}
+	s := &subscriber{
+		filter: filter,
+		out:    make(chan Event),
+		done:   make(chan struct{}),
+	}
+	if len(filter.Types) > 0 {
+		s.types = make(map[EventType]bool, len(filter.Types))
+		for _, t := range filter.Types {
+			s.types[t] = true
+		}
+	}
+	s.cond = sync.NewCond(&s.lock)
+	return s
+}
+
+// Checks if the subscriber wants the event
+func (s *subscriber) matches(ev *Event) bool {
+	return s.types == nil || s.types[ev.Type]
+}
+
+// Queues an event, applying the overflow policy.  Delegate functions and the
+// blocking types wait for room, making it by dropping an event that does not
+// if there is one.
+func (s *subscriber) push(ev Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case s.filter.Overflow == OverflowBlock || s.mustQueue(&ev):
+		for !s.closed && len(s.queue) >= s.filter.Buffer && !s.dropOldest() {
+			s.cond.Wait()
+		}
+	case s.filter.Overflow == OverflowCoalesce:
+		for i := range s.queue {
+			if !sameEventKey(&s.queue[i], &ev) {
+				continue
+			}
+			ev = collapseEvent(&s.queue[i], ev)
+			if unchanged(&ev) {
+				// Nothing changed since before the queued event
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				s.cond.Broadcast()
+			} else {
+				s.queue[i] = ev
+			}
+			return
+		}
+	}
+	if s.closed {
+		return
+	}
+
+	// Make room by dropping the oldest event, or this one if all the queued
+	// events must be kept
+	if len(s.queue) >= s.filter.Buffer && !s.dropOldest() {
+		return
+	}
+	s.queue = append(s.queue, ev)
+	s.cond.Broadcast()
+}
+
+// Checks if an event must wait for room rather than be dropped
+func (s *subscriber) mustQueue(ev *Event) bool {
+	return ev.fn != nil || s.blocking[ev.Type]
+}
+
+// Drops the oldest queued event that may be dropped.  Returns false if there
+// is none or the policy blocks.
+func (s *subscriber) dropOldest() bool {
+	if s.filter.Overflow == OverflowBlock {
+		return false
+	}
+	for i := range s.queue {
+		if !s.mustQueue(&s.queue[i]) {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Feeds the queued events to the channel until cancelled, or closed and
+// drained
+func (s *subscriber) run() {
+	defer close(s.out)
+	for {
+		s.lock.Lock()
+		for !s.closed && len(s.queue) == 0 {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.lock.Unlock()
+			return
+		}
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+
+		// Wake up blocked publishers
+		s.cond.Broadcast()
+		s.lock.Unlock()
+
+		select {
+		case s.out <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Stops queueing events, the channel is closed once the queue is drained
+func (s *subscriber) close() {
+	s.lock.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+// Stops the subscriber right away, discarding the queued events
+func (s *subscriber) cancel() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.lock.Lock()
+	s.closed = true
+	s.queue = nil
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+// Collapses an event into the older queued one it replaces.  The result goes
+// from the state before the older event to the state after the newer one, so
+// the subscriber never sees a transition from a state it was not told about.
+func collapseEvent(older *Event, newer Event) Event {
+	switch newer.Type {
+	case EventNewPredecessor, EventNewSuccessor, EventFingerChanged:
+		newer.Prev = older.Prev
+	case EventSuccessorsChanged:
+		newer.PrevSuccessors = older.PrevSuccessors
+	}
+	return newer
+}
+
+// Checks if a collapsed event ends where it started
+func unchanged(ev *Event) bool {
+	switch ev.Type {
+	case EventNewPredecessor, EventNewSuccessor, EventFingerChanged:
+		return sameVnode(ev.Prev, ev.Remote)
+	case EventSuccessorsChanged:
+		return sameVnodes(ev.PrevSuccessors, ev.Successors)
+	}
+	return false
+}
+
+// Checks if two events describe the same state, so the newer can replace the
+// older when coalescing
+func sameEventKey(a, b *Event) bool {
+	if a.Type != b.Type || a.fn != nil || b.fn != nil {
+		return false
+	}
+	if a.Type == EventRangeGained || a.Type == EventRangeLost || a.Type == EventStateChanged {
+		return false
+	}
+	if (a.Local == nil) != (b.Local == nil) {
+		return false
+	}
+	if a.Local != nil && a.Local.StringID() != b.Local.StringID() {
+		return false
+	}
+	if a.Finger != nil && b.Finger != nil {
+		return a.Finger.Start == b.Finger.Start && a.Finger.End == b.Finger.End
+	}
+	return true
+}
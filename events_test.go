@@ -0,0 +1,332 @@
+package chord
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+type MockSuccessorDelegate struct {
+	MockDelegate
+	lock    sync.Mutex
+	succs   map[string][]*Vnode
+	fingers int
+	err     error
+}
+
+func (m *MockSuccessorDelegate) SuccessorsChanged(local *Vnode, prev, succs []*Vnode) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// Each change follows on from the last one
+	if last, ok := m.succs[local.StringID()]; ok && !sameVnodes(last, prev) && m.err == nil {
+		m.err = fmt.Errorf("change of %s does not follow the last one", local)
+	}
+	m.succs[local.StringID()] = succs
+}
+func (m *MockSuccessorDelegate) FingerChanged(local *Vnode, fingers FingerRange, prev *Vnode) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if fingers.Vnode == nil || fingers.Start > fingers.End || sameVnode(prev, fingers.Vnode) {
+		m.err = fmt.Errorf("bad finger change %v", fingers)
+	}
+	m.fingers++
+}
+
+// Blocks in NewPredecessor until released
+type BlockingDelegate struct {
+	MockSuccessorDelegate
+	release chan struct{}
+}
+
+func (b *BlockingDelegate) NewPredecessor(local, remoteNew, remotePrev *Vnode) {
+	<-b.release
+}
+
+func TestSubscribe(t *testing.T) {
+	ml := InitMLTransport()
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	filter := EventFilter{Types: []EventType{EventNewPredecessor, EventNewSuccessor}, Buffer: 128}
+	events, cancel := r.Subscribe(filter)
+	all, cancelAll := r.Subscribe(EventFilter{})
+	defer cancelAll()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+
+	// The new host becomes both a predecessor and a successor
+	seen := make(map[EventType]bool)
+	timeout := time.After(5 * time.Second)
+	for !seen[EventNewPredecessor] || !seen[EventNewSuccessor] {
+		select {
+		case ev := <-events:
+			if ev.Type != EventNewPredecessor && ev.Type != EventNewSuccessor {
+				t.Fatalf("unexpected event %s", ev.Type)
+			}
+			if ev.Local.Host != "test" || ev.Time.IsZero() {
+				t.Fatalf("bad event %v", ev)
+			}
+			if ev.Remote.Host == "test2" {
+				seen[ev.Type] = true
+			}
+		case <-timeout:
+			t.Fatalf("missing events %v", seen)
+		}
+	}
+
+	// Cancelling closes the channel
+	cancel()
+	for range events {
+	}
+
+	// Every subscriber gets its own copy
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("missing event")
+	}
+}
+
+func TestSubscribeShutdown(t *testing.T) {
+	ml := InitMLTransport()
+	r, err := Create(fastConf(), ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	events, cancel := r.Subscribe(EventFilter{Types: []EventType{EventShutdown}})
+	defer cancel()
+	r.Shutdown()
+
+	var last Event
+	for ev := range events {
+		last = ev
+	}
+	if last.Type != EventShutdown {
+		t.Fatalf("expected shutdown event, got %s", last.Type)
+	}
+
+	// Subscribing once shut down gets a closed channel
+	events, _ = r.Subscribe(EventFilter{})
+	if _, ok := <-events; ok {
+		t.Fatalf("expected closed channel")
+	}
+}
+
+func TestSubscriberDropOldest(t *testing.T) {
+	s := newSubscriber(EventFilter{Buffer: 2})
+	for i := 0; i < 3; i++ {
+		s.push(Event{Type: EventStabilized, Finger: &FingerRange{Start: i}})
+	}
+	if len(s.queue) != 2 || s.queue[0].Finger.Start != 1 || s.queue[1].Finger.Start != 2 {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+}
+
+func TestSubscriberCoalesce(t *testing.T) {
+	s := newSubscriber(EventFilter{Buffer: 4, Overflow: OverflowCoalesce})
+	a := &Vnode{Id: []byte{1}}
+	b := &Vnode{Id: []byte{2}}
+	s.push(Event{Type: EventNewSuccessor, Local: a, Remote: b})
+	s.push(Event{Type: EventNewSuccessor, Local: b, Remote: a})
+	s.push(Event{Type: EventNewSuccessor, Local: a, Remote: a})
+	if len(s.queue) != 2 || s.queue[0].Remote != a || s.queue[1].Local != b {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+
+	// Range events are kept
+	s.push(Event{Type: EventRangeLost, Local: a})
+	s.push(Event{Type: EventRangeLost, Local: a})
+	if len(s.queue) != 4 {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+}
+
+func TestSubscriberCoalescePrev(t *testing.T) {
+	s := newSubscriber(EventFilter{Buffer: 4, Overflow: OverflowCoalesce})
+	a := &Vnode{Id: []byte{1}}
+	b := &Vnode{Id: []byte{2}}
+	c := &Vnode{Id: []byte{3}}
+
+	// The collapsed change starts where the first one did
+	s.push(Event{Type: EventNewPredecessor, Local: a, Remote: b, Prev: c})
+	s.push(Event{Type: EventNewPredecessor, Local: a, Remote: a, Prev: b})
+	if len(s.queue) != 1 || s.queue[0].Prev != c || s.queue[0].Remote != a {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+	s.push(Event{Type: EventSuccessorsChanged, Local: a, PrevSuccessors: []*Vnode{c}, Successors: []*Vnode{b}})
+	s.push(Event{Type: EventSuccessorsChanged, Local: a, PrevSuccessors: []*Vnode{b}, Successors: []*Vnode{b, c}})
+	if len(s.queue) != 2 || !sameVnodes(s.queue[1].PrevSuccessors, []*Vnode{c}) ||
+		!sameVnodes(s.queue[1].Successors, []*Vnode{b, c}) {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+
+	// Changing back drops the change
+	s.push(Event{Type: EventNewPredecessor, Local: a, Remote: c, Prev: a})
+	if len(s.queue) != 1 || s.queue[0].Type != EventSuccessorsChanged {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+}
+
+func TestSubscriberBlockingTypes(t *testing.T) {
+	s := newSubscriber(EventFilter{Buffer: 2, Overflow: OverflowCoalesce})
+	s.blocking = map[EventType]bool{EventNewPredecessor: true}
+	a := &Vnode{Id: []byte{1}}
+	s.push(Event{Type: EventStabilized, Local: a})
+	s.push(Event{Type: EventNewPredecessor, Local: a, Remote: a})
+
+	// The blocking events make room by dropping the others
+	s.push(Event{Type: EventNewPredecessor, Local: a, Remote: a})
+	if len(s.queue) != 2 || s.queue[0].Type != EventNewPredecessor || s.queue[1].Type != EventNewPredecessor {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+
+	// The others are dropped when only blocking events are queued
+	s.push(Event{Type: EventFingerChanged, Local: a})
+	if len(s.queue) != 2 || s.queue[1].Type != EventNewPredecessor {
+		t.Fatalf("bad queue %v", s.queue)
+	}
+}
+
+func TestSubscriberBlock(t *testing.T) {
+	s := newSubscriber(EventFilter{Buffer: 1, Overflow: OverflowBlock})
+	s.push(Event{Type: EventStabilized})
+
+	pushed := make(chan struct{})
+	go func() {
+		s.push(Event{Type: EventShutdown})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatalf("push should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Consuming makes room
+	go s.run()
+	if ev := <-s.out; ev.Type != EventStabilized {
+		t.Fatalf("bad event %s", ev.Type)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatalf("push still blocked")
+	}
+	if ev := <-s.out; ev.Type != EventShutdown {
+		t.Fatalf("bad event %s", ev.Type)
+	}
+
+	// Cancelling releases blocked publishers
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			s.push(Event{Type: EventStabilized})
+		}
+		close(done)
+	}()
+	s.cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("push still blocked")
+	}
+	for range s.out {
+	}
+}
+
+func TestSuccessorDelegate(t *testing.T) {
+	d := &MockSuccessorDelegate{succs: make(map[string][]*Vnode)}
+	ml := InitMLTransport()
+	conf := fastConf()
+	conf.Delegate = d
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	// Wait for the delegate to catch up
+	r.Shutdown()
+
+	if d.err != nil {
+		t.Fatalf("unexpected err %s", d.err)
+	}
+	if d.fingers == 0 {
+		t.Fatalf("expected finger changes")
+	}
+	for _, info := range r.Vnodes() {
+		if !sameVnodes(d.succs[info.Vnode.StringID()], info.Successors) {
+			t.Fatalf("last change of %s does not match its successors", info.Vnode)
+		}
+	}
+}
+
+func TestDelegateBlocked(t *testing.T) {
+	d := &BlockingDelegate{
+		MockSuccessorDelegate: MockSuccessorDelegate{succs: make(map[string][]*Vnode)},
+		release:               make(chan struct{}),
+	}
+	ml := InitMLTransport()
+	conf := fastConf()
+	conf.Delegate = d
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+	defer close(d.release)
+
+	// The stuck delegate does not hold up the joins and stabilization
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitStable(t, r, r2)
+
+	// Nor the notifications of a new predecessor
+	vn := r.vnodes[0]
+	pred := &Vnode{Id: make([]byte, len(vn.Id)), Host: "test3"}
+	copy(pred.Id, vn.Id)
+	for i := len(pred.Id) - 1; i >= 0; i-- {
+		if pred.Id[i]--; pred.Id[i] != 0xff {
+			break
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		vn.Notify(context.Background(), pred)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("notify blocked on the delegate")
+	}
+	if p, _ := vn.GetPredecessor(context.Background()); !sameVnode(p, pred) {
+		t.Fatalf("expected the new predecessor, got %s", p)
+	}
+}
@@ -0,0 +1,184 @@
+package chord
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of heartbeat intervals kept for each host
+	detectorWindow = 100
+
+	// Hosts not heard of for this many bootstrap intervals are forgotten
+	detectorExpiry = 10
+)
+
+// Tracks the heartbeats of the remote hosts to compute their phi-accrual
+// suspicion level.  The zero value is ready to use.
+type failureDetector struct {
+	lock      sync.Mutex
+	hosts     map[string]*heartbeatHistory
+	lastPrune time.Time
+}
+
+// Heartbeat history of a host
+type heartbeatHistory struct {
+	last      time.Time       // Last heartbeat, or the first failure if none
+	touched   time.Time       // Last heartbeat or failure
+	intervals []time.Duration // Most recent intervals between heartbeats
+	next      int             // Next interval to overwrite once the window is full
+}
+
+// Records an interval, overwriting the oldest one once the window is full
+func (h *heartbeatHistory) add(interval time.Duration) {
+	if len(h.intervals) < detectorWindow {
+		h.intervals = append(h.intervals, interval)
+		return
+	}
+	h.intervals[h.next] = interval
+	h.next = (h.next + 1) % detectorWindow
+}
+
+// Returns the suspicion level at the given time.  Until a heartbeat interval
+// is known, the bootstrap interval is used as the mean.
+func (h *heartbeatHistory) phi(now time.Time, bootstrap time.Duration) float64 {
+	mean := float64(bootstrap)
+	if n := len(h.intervals); n > 0 {
+		var sum float64
+		for _, i := range h.intervals {
+			sum += float64(i)
+		}
+		mean = sum / float64(n)
+	}
+	var variance float64
+	for _, i := range h.intervals {
+		d := float64(i) - mean
+		variance += d * d
+	}
+	if n := len(h.intervals); n > 0 {
+		variance /= float64(n)
+	}
+
+	// Keep a floor on the deviation so a perfectly regular host is not
+	// suspected on the slightest delay
+	stdDev := math.Max(math.Sqrt(variance), mean/4)
+	if stdDev <= 0 {
+		return 0
+	}
+	return phi(float64(now.Sub(h.last)), mean, stdDev)
+}
+
+// Returns the suspicion level of a host not heard of for elapsed, given the
+// mean and the standard deviation of its heartbeat intervals.  Uses the
+// logistic approximation of the normal distribution.
+func phi(elapsed, mean, stdDev float64) float64 {
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
+
+// Returns the history of a host, creating it if needed.  Must be called with
+// the lock held.
+func (d *failureDetector) history(host string, now time.Time) *heartbeatHistory {
+	if d.hosts == nil {
+		d.hosts = make(map[string]*heartbeatHistory)
+	}
+	h, ok := d.hosts[host]
+	if !ok {
+		h = &heartbeatHistory{last: now}
+		d.hosts[host] = h
+	}
+	h.touched = now
+	return h
+}
+
+// Forgets the hosts nobody heard of for the given age.  Must be called with
+// the lock held.
+func (d *failureDetector) prune(now time.Time, maxAge time.Duration) {
+	if maxAge <= 0 || now.Sub(d.lastPrune) < maxAge {
+		return
+	}
+	d.lastPrune = now
+	for host, h := range d.hosts {
+		if now.Sub(h.touched) > maxAge {
+			delete(d.hosts, host)
+		}
+	}
+}
+
+// Records a heartbeat from a host
+func (d *failureDetector) heartbeat(host string, now time.Time, bootstrap time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.prune(now, detectorExpiry*bootstrap)
+	if h, ok := d.hosts[host]; ok {
+		h.add(now.Sub(h.last))
+		h.last = now
+		h.touched = now
+		return
+	}
+	d.history(host, now)
+}
+
+// Records a failure to reach a host and returns its suspicion level.  The
+// suspicion of a host never heard of grows from its first failure.
+func (d *failureDetector) failure(host string, now time.Time, bootstrap time.Duration) float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.history(host, now).phi(now, bootstrap)
+}
+
+// Returns the suspicion level of a host, 0 if it is not tracked
+func (d *failureDetector) suspicion(host string, now time.Time, bootstrap time.Duration) float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if h, ok := d.hosts[host]; ok {
+		return h.phi(now, bootstrap)
+	}
+	return 0
+}
+
+// Returns the suspicion level of every host tracked
+func (d *failureDetector) suspicions(now time.Time, bootstrap time.Duration) map[string]float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	out := make(map[string]float64, len(d.hosts))
+	for host, h := range d.hosts {
+		out[host] = h.phi(now, bootstrap)
+	}
+	return out
+}
+
+// Records a successful contact with a remote host
+func (r *Ring) heartbeat(host string) {
+	if host == r.config.Hostname {
+		return
+	}
+	r.detector.heartbeat(host, time.Now(), r.config.StabilizeMax)
+}
+
+// Records a failure to reach a host and returns whether it should be
+// declared dead.  Without a threshold, or for the local host whose vnodes
+// are known exactly, the first failure is enough.
+func (r *Ring) suspect(host string) bool {
+	if r.config.PhiThreshold <= 0 || host == r.config.Hostname {
+		return true
+	}
+	return r.detector.failure(host, time.Now(), r.config.StabilizeMax) >= r.config.PhiThreshold
+}
+
+// Suspicion returns the phi-accrual suspicion level of a remote host, which
+// grows the longer the host goes without answering compared to its usual
+// heartbeat interval.  Hosts not tracked have a level of 0.
+func (r *Ring) Suspicion(host string) float64 {
+	return r.detector.suspicion(host, time.Now(), r.config.StabilizeMax)
+}
+
+// Suspicions returns the suspicion level of every remote host tracked
+func (r *Ring) Suspicions() map[string]float64 {
+	return r.detector.suspicions(time.Now(), r.config.StabilizeMax)
+}
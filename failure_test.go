@@ -0,0 +1,145 @@
+package chord
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPhi(t *testing.T) {
+	// Grows with the time since the last heartbeat
+	last := -1.0
+	for _, elapsed := range []float64{0, 50, 100, 150, 200, 300} {
+		p := phi(elapsed, 100, 25)
+		if p < last {
+			t.Fatalf("phi should grow, %f after %f", p, last)
+		}
+		last = p
+	}
+	if p := phi(100, 100, 25); p < 0.2 || p > 0.4 {
+		t.Fatalf("expected about 0.3 at the mean, got %f", p)
+	}
+	if p := phi(300, 100, 25); p < 8 {
+		t.Fatalf("expected a high suspicion, got %f", p)
+	}
+}
+
+func TestFailureDetector(t *testing.T) {
+	var d failureDetector
+	start := time.Now()
+	interval := 100 * time.Millisecond
+
+	// Regular heartbeats
+	now := start
+	for i := 0; i < 10; i++ {
+		d.heartbeat("remote", now, time.Second)
+		now = now.Add(interval)
+	}
+	last := now.Add(-interval)
+
+	if p := d.suspicion("remote", last.Add(interval/2), time.Second); p > 1 {
+		t.Fatalf("should not be suspected yet, got %f", p)
+	}
+	if p := d.suspicion("remote", last.Add(10*interval), time.Second); p < 8 {
+		t.Fatalf("should be suspected, got %f", p)
+	}
+	if p := d.suspicion("unknown", now, time.Second); p != 0 {
+		t.Fatalf("unknown host should not be suspected, got %f", p)
+	}
+
+	// Failures of an unknown host start from the bootstrap interval
+	if p := d.failure("other", now, time.Second); p > 1 {
+		t.Fatalf("should not be suspected yet, got %f", p)
+	}
+	if p := d.failure("other", now.Add(5*time.Second), time.Second); p < 8 {
+		t.Fatalf("should be suspected, got %f", p)
+	}
+
+	all := d.suspicions(now, time.Second)
+	var hosts []string
+	for host := range all {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	if len(hosts) != 2 || hosts[0] != "other" || hosts[1] != "remote" {
+		t.Fatalf("bad hosts %v", hosts)
+	}
+
+	// Hosts gone quiet are forgotten
+	d.heartbeat("remote", now.Add(time.Hour), time.Second)
+	if _, ok := d.suspicions(now, time.Second)["other"]; ok {
+		t.Fatalf("expected other to be forgotten")
+	}
+}
+
+func TestHeartbeatWindow(t *testing.T) {
+	var h heartbeatHistory
+	for i := 0; i < detectorWindow+10; i++ {
+		h.add(time.Duration(i))
+	}
+	if len(h.intervals) != detectorWindow || h.intervals[0] != detectorWindow || h.intervals[9] != detectorWindow+9 {
+		t.Fatalf("bad window %v", h.intervals[:10])
+	}
+}
+
+func TestVnodeCheckSuspectedPred(t *testing.T) {
+	r := makeRing()
+	r.config.PhiThreshold = 8
+	sort.Sort(r)
+
+	// The blackhole transport never answers the remote host
+	vn := r.vnodes[0]
+	pred := &Vnode{Id: []byte{1}, Host: "remote"}
+	vn.predecessor = pred
+
+	// A single missed ping is tolerated
+	r.heartbeat("remote")
+	if err := vn.checkPredecessor(); err != nil {
+		t.Fatalf("unexpected error! %s", err)
+	}
+	if vn.predecessor != pred {
+		t.Fatalf("predecessor should be kept")
+	}
+	if r.Suspicion("remote") <= 0 {
+		t.Fatalf("expected some suspicion")
+	}
+
+	// Long silence gets it declared dead
+	r.detector.hosts["remote"].last = time.Now().Add(-time.Minute)
+	if err := vn.checkPredecessor(); err != nil {
+		t.Fatalf("unexpected error! %s", err)
+	}
+	if vn.predecessor != nil {
+		t.Fatalf("predecessor should be cleared")
+	}
+}
+
+func TestVnodeCheckNewSuccSuspected(t *testing.T) {
+	r := makeRing()
+	r.config.PhiThreshold = 8
+	sort.Sort(r)
+
+	vn1 := r.vnodes[0]
+	vn2 := r.vnodes[1]
+	remote := &Vnode{Id: []byte{1}, Host: "remote"}
+	vn1.successors[0] = remote
+	vn1.successors[1] = &vn2.Vnode
+
+	// Kept while not suspected enough
+	r.heartbeat("remote")
+	if err := vn1.checkNewSuccessor(); err == nil {
+		t.Fatalf("expected error")
+	}
+	if vn1.successors[0] != remote {
+		t.Fatalf("successor should be kept")
+	}
+
+	// Dropped once suspected
+	r.detector.hosts["remote"].last = time.Now().Add(-time.Minute)
+	if err := vn1.checkNewSuccessor(); err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if vn1.successors[0] != &vn2.Vnode {
+		t.Fatalf("unexpected successor!")
+	}
+}
@@ -0,0 +1,111 @@
+package chord
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// Default bound on the handoff of the leaving vnodes
+const defaultHandoffTimeout = 30 * time.Second
+
+// HandoffDelegate can optionally be implemented by a Delegate to hand the
+// range of a leaving vnode over before it unlinks from the ring.  Unlike the
+// other callbacks it is invoked from the goroutine leaving the ring.
+type HandoffDelegate interface {
+	// Handoff transfers the range of the local vnode to the vnode taking it
+	// over, rng.Vnode, and returns once that vnode acknowledged it.  The
+	// context is cancelled when the handoff timeout expires, which bounds
+	// the handoffs of all the vnodes leaving together.
+	Handoff(ctx context.Context, local *Vnode, rng *KeyRange) error
+}
+
+// Returns the range of a leaving vnode, owned by the first of its successors
+// that is not leaving as well.  Nil if the range is not known or nobody is
+// left to take it over.
+func (vn *localVnode) handoffRange(leaving map[string]bool) *KeyRange {
+	vn.lock.RLock()
+	start := vn.predecessor
+	if start == nil {
+		start = vn.owned
+	}
+	succs := make([]*Vnode, len(vn.successors))
+	copy(succs, vn.successors)
+	vn.lock.RUnlock()
+
+	if start == nil {
+		return nil
+	}
+	for _, s := range succs {
+		if s != nil && !leaving[s.StringID()] && s.StringID() != vn.StringID() {
+			return &KeyRange{Vnode: s, Start: start.Id, End: vn.Id}
+		}
+	}
+	return nil
+}
+
+// Hands the range of a leaving vnode over to the vnode taking it over,
+// waiting for the delegate until the context is done
+func (vn *localVnode) handoff(ctx context.Context, leaving map[string]bool) error {
+	rng := vn.handoffRange(leaving)
+	if rng == nil {
+		return nil
+	}
+	vn.publishOwnership(nil, rng, nil)
+
+	hd, ok := vn.ring.config.Delegate.(HandoffDelegate)
+	if !ok {
+		return nil
+	}
+
+	// Don't wait past the timeout on a delegate ignoring the context
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("handoff panicked: %v", r)
+			}
+		}()
+		done <- hd.Handoff(ctx, &vn.Vnode, rng)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		log.Printf("[ERR] Failed to hand off %s to %s: %s", vn.StringID(), rng.Vnode.StringID(), err)
+		return fmt.Errorf("handoff of %s failed: %s", vn.StringID(), err)
+	}
+	return nil
+}
+
+// Hands off the ranges of the leaving vnodes, before any of them unlinks.
+// The handoff timeout bounds them all, so the vnodes left once it expires
+// fail right away.
+func handoffVnodes(vnodes []*localVnode) error {
+	if len(vnodes) == 0 {
+		return nil
+	}
+	leaving := make(map[string]bool, len(vnodes))
+	for _, vn := range vnodes {
+		leaving[vn.StringID()] = true
+	}
+
+	ctx := context.Background()
+	if timeout := vnodes[0].ring.config.HandoffTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var err error
+	for _, vn := range vnodes {
+		err = mergeErrors(err, vn.handoff(ctx, leaving))
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package chord
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+type MockHandoffDelegate struct {
+	MockDelegate
+	lock   sync.Mutex
+	ranges map[string]*KeyRange
+	block  bool // Wait for the context instead of acknowledging
+}
+
+func (m *MockHandoffDelegate) Handoff(ctx context.Context, local *Vnode, rng *KeyRange) error {
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	m.lock.Lock()
+	m.ranges[local.StringID()] = rng
+	m.lock.Unlock()
+	return nil
+}
+
+// Sets the handoff delegate of the second host
+func handoffSetup(d *MockHandoffDelegate) func(*Config) {
+	return func(conf *Config) {
+		if conf.Hostname == "test2" {
+			conf.Delegate = d
+			conf.HandoffTimeout = 20 * time.Millisecond
+		}
+	}
+}
+
+func TestLeaveHandoff(t *testing.T) {
+	d := &MockHandoffDelegate{ranges: make(map[string]*KeyRange)}
+	rings := makeRings(t, InitMLTransport(), 2, handoffSetup(d))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+
+	vnodes := r2.Vnodes()
+	if err := r2.Leave(); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	// Every range goes to a vnode staying in the ring
+	if len(d.ranges) != len(vnodes) {
+		t.Fatalf("expected %d handoffs, got %d", len(vnodes), len(d.ranges))
+	}
+	for _, info := range vnodes {
+		rng := d.ranges[info.Vnode.StringID()]
+		if rng == nil {
+			t.Fatalf("missing handoff of %s", info.Vnode)
+		}
+		if rng.Vnode.Host != "test" || !bytes.Equal(rng.End, info.Vnode.Id) || !bytes.Equal(rng.Start, info.Predecessor.Id) {
+			t.Fatalf("bad handoff of %s: %v", info.Vnode, rng)
+		}
+	}
+}
+
+func TestLeaveHandoffTimeout(t *testing.T) {
+	d := &MockHandoffDelegate{block: true}
+	rings := makeRings(t, InitMLTransport(), 2, handoffSetup(d))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	r2.config.HandoffTimeout = 100 * time.Millisecond
+
+	// One timeout bounds the handoffs of every vnode
+	start := time.Now()
+	err := r2.Leave()
+	if err == nil || !strings.Contains(err.Error(), "handoff") {
+		t.Fatalf("expected handoff err, got %v", err)
+	}
+	if diff := time.Since(start); diff > 400*time.Millisecond {
+		t.Fatalf("leave took too long: %s", diff)
+	}
+
+	// The vnodes still unlink
+	for _, vn := range r.localVnodes() {
+		vn.lock.RLock()
+		pred := vn.predecessor
+		vn.lock.RUnlock()
+		if pred != nil && pred.Host == "test2" {
+			t.Fatalf("vnode %s still linked to %s", vn, pred)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package chord
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+// IDGenerator assigns the IDs of the local vnodes.  The ID must be as long as
+// the output of the configured hash function.
+type IDGenerator interface {
+	// GenerateID returns the ID of the local vnode with the given index
+	GenerateID(conf *Config, idx int) ([]byte, error)
+}
+
+// IDCollisionError is returned when a local vnode would take the ID of a vnode
+// on another host
+type IDCollisionError struct {
+	Local    *Vnode // Local vnode being placed
+	Existing *Vnode // Vnode already using the ID
+}
+
+func (e *IDCollisionError) Error() string {
+	return fmt.Sprintf("vnode ID %s of %s is already used by %s",
+		e.Local.StringID(), e.Local.Host, e.Existing.Host)
+}
+
+// Returns an IDCollisionError if the successor found for a vnode has the same
+// ID.  A vnode with the same ID and host is a stale entry of the same vnode,
+// left behind by a restart, and is not a collision.
+func checkCollision(vn *Vnode, succs []*Vnode) error {
+	if len(succs) == 0 || succs[0] == nil {
+		return nil
+	}
+	if s := succs[0]; bytes.Equal(s.Id, vn.Id) && s.Host != vn.Host {
+		return &IDCollisionError{Local: vn, Existing: s}
+	}
+	return nil
+}
+
+// Returns an IDCollisionError if one of the vnodes listed by a remote host has
+// the ID of a local vnode
+func (r *Ring) checkRemoteCollision(remote []*Vnode) error {
+	local := make(map[string]*Vnode, len(r.vnodes))
+	for _, vn := range r.vnodes {
+		local[vn.StringID()] = &vn.Vnode
+	}
+	for _, rv := range remote {
+		if vn, ok := local[rv.StringID()]; ok && rv.Host != vn.Host {
+			return &IDCollisionError{Local: vn, Existing: rv}
+		}
+	}
+	return nil
+}
+
+// HostnameIDGenerator hashes the hostname together with the vnode index.  It
+// is the default and gives a node the same IDs across restarts, but nodes
+// sharing a hostname collide.
+type HostnameIDGenerator struct{}
+
+// GenerateID hashes the hostname and index
+func (HostnameIDGenerator) GenerateID(conf *Config, idx int) ([]byte, error) {
+	hash := conf.HashFunc()
+	hash.Write([]byte(conf.Hostname))
+	binary.Write(hash, binary.BigEndian, uint16(idx))
+	return hash.Sum(nil), nil
+}
+
+// RandomIDGenerator assigns random IDs.  If Path is set the IDs are saved to
+// that file, one hex encoded ID per line, and reused after a restart.
+type RandomIDGenerator struct {
+	Path   string
+	lock   sync.Mutex
+	loaded bool
+	ids    [][]byte
+}
+
+// NewRandomIDGenerator returns a RandomIDGenerator persisting its IDs to
+// the given file.  An empty path keeps them in memory only.
+func NewRandomIDGenerator(path string) *RandomIDGenerator {
+	return &RandomIDGenerator{Path: path}
+}
+
+// GenerateID returns the saved ID for the index or generates a new one
+func (g *RandomIDGenerator) GenerateID(conf *Config, idx int) ([]byte, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if !g.loaded {
+		if err := g.load(); err != nil {
+			return nil, err
+		}
+		g.loaded = true
+	}
+
+	size := conf.HashFunc().Size()
+	if idx < len(g.ids) {
+		if len(g.ids[idx]) != size {
+			return nil, fmt.Errorf("saved ID %d is %d bytes, expected %d", idx, len(g.ids[idx]), size)
+		}
+		return copyBytes(g.ids[idx]), nil
+	}
+
+	// Generate the missing IDs and save them before handing any out
+	num := len(g.ids)
+	for len(g.ids) <= idx {
+		id := make([]byte, size)
+		if _, err := rand.Read(id); err != nil {
+			g.ids = g.ids[:num]
+			return nil, err
+		}
+		g.ids = append(g.ids, id)
+	}
+	if err := g.save(); err != nil {
+		g.ids = g.ids[:num]
+		return nil, err
+	}
+	return copyBytes(g.ids[idx]), nil
+}
+
+// Reads the saved IDs, a missing file has none
+func (g *RandomIDGenerator) load() error {
+	if g.Path == "" {
+		return nil
+	}
+	f, err := os.Open(g.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		id, err := hex.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("bad ID in %s: %s", g.Path, err)
+		}
+		g.ids = append(g.ids, id)
+	}
+	return scanner.Err()
+}
+
+// Atomically replaces the file with the current IDs
+func (g *RandomIDGenerator) save() error {
+	if g.Path == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, id := range g.ids {
+		fmt.Fprintf(&buf, "%x\n", id)
+	}
+	tmp := g.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.Path)
+}
+
+// TokenIDGenerator spaces the IDs of a fixed set of nodes evenly around the
+// ring.  Every node must use the same Nodes and NumVnodes and a distinct Node
+// in [0, Nodes), which splits the ring into Nodes*NumVnodes equal arcs with
+// the vnodes of each node interleaved.  A node has exactly NumVnodes tokens,
+// so AddVnodes can only bring back the vnodes removed by RemoveVnodes.
+type TokenIDGenerator struct {
+	Node  int // Position of this node
+	Nodes int // Total number of nodes
+}
+
+// Checks if the generator hands out a fixed set of tokens
+func isTokenGenerator(gen IDGenerator) bool {
+	switch gen.(type) {
+	case TokenIDGenerator, *TokenIDGenerator:
+		return true
+	}
+	return false
+}
+
+// GenerateID returns the start of the arc assigned to the index
+func (g TokenIDGenerator) GenerateID(conf *Config, idx int) ([]byte, error) {
+	if g.Nodes <= 0 || g.Node < 0 || g.Node >= g.Nodes {
+		return nil, fmt.Errorf("bad token node %d of %d", g.Node, g.Nodes)
+	}
+	if idx < 0 || idx >= conf.NumVnodes {
+		return nil, fmt.Errorf("vnode index %d outside of the %d tokens per node", idx, conf.NumVnodes)
+	}
+
+	// Compute (idx*Nodes + Node) * 2^bits / (Nodes*NumVnodes)
+	size := conf.HashFunc().Size()
+	space := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	id := new(big.Int).Mul(space, big.NewInt(int64(idx*g.Nodes+g.Node)))
+	id.Div(id, big.NewInt(int64(g.Nodes*conf.NumVnodes)))
+
+	// Left pad to the hash size
+	out := make([]byte, size)
+	b := id.Bytes()
+	copy(out[size-len(b):], b)
+	return out, nil
+}
+
+// Returns a copy of a byte slice
+func copyBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
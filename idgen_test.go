@@ -0,0 +1,190 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type constIDGenerator []byte
+
+func (c constIDGenerator) GenerateID(conf *Config, idx int) ([]byte, error) {
+	return c, nil
+}
+
+func TestHostnameIDGenerator(t *testing.T) {
+	conf := DefaultConfig("test")
+	id, err := HostnameIDGenerator{}.GenerateID(conf, 3)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte("test"))
+	binary.Write(hash, binary.BigEndian, uint16(3))
+	if !bytes.Equal(id, hash.Sum(nil)) {
+		t.Fatalf("bad id %x", id)
+	}
+
+	other, _ := HostnameIDGenerator{}.GenerateID(conf, 4)
+	if bytes.Equal(id, other) {
+		t.Fatalf("ids should differ")
+	}
+}
+
+func TestRandomIDGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chord")
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ids")
+
+	conf := DefaultConfig("test")
+	gen := NewRandomIDGenerator(path)
+	ids := make([][]byte, 3)
+	for i := range ids {
+		if ids[i], err = gen.GenerateID(conf, i); err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+		if len(ids[i]) != 20 {
+			t.Fatalf("bad id len %d", len(ids[i]))
+		}
+	}
+	if bytes.Equal(ids[0], ids[1]) {
+		t.Fatalf("ids should differ")
+	}
+
+	// A new generator should load the same IDs
+	gen2 := NewRandomIDGenerator(path)
+	for i := len(ids) - 1; i >= 0; i-- {
+		id, err := gen2.GenerateID(conf, i)
+		if err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+		if !bytes.Equal(id, ids[i]) {
+			t.Fatalf("id %d not persisted", i)
+		}
+	}
+
+	// Reject a corrupt file
+	ioutil.WriteFile(path, []byte("zz\n"), 0644)
+	if _, err := NewRandomIDGenerator(path).GenerateID(conf, 0); err == nil {
+		t.Fatalf("expected err!")
+	}
+}
+
+func TestTokenIDGenerator(t *testing.T) {
+	conf := DefaultConfig("test")
+	conf.NumVnodes = 4
+
+	// Tokens of 2 nodes should be spaced 2^160/8 apart
+	step := new(big.Int).Lsh(big.NewInt(1), 157)
+	for node := 0; node < 2; node++ {
+		gen := TokenIDGenerator{Node: node, Nodes: 2}
+		for idx := 0; idx < conf.NumVnodes; idx++ {
+			id, err := gen.GenerateID(conf, idx)
+			if err != nil {
+				t.Fatalf("unexpected err. %s", err)
+			}
+			if len(id) != 20 {
+				t.Fatalf("bad id len %d", len(id))
+			}
+			expect := new(big.Int).Mul(step, big.NewInt(int64(idx*2+node)))
+			if new(big.Int).SetBytes(id).Cmp(expect) != 0 {
+				t.Fatalf("bad token for %d/%d: %x", node, idx, id)
+			}
+		}
+	}
+
+	if _, err := (TokenIDGenerator{Node: 2, Nodes: 2}).GenerateID(conf, 0); err == nil {
+		t.Fatalf("expected err!")
+	}
+	if _, err := (TokenIDGenerator{Node: 0, Nodes: 2}).GenerateID(conf, 4); err == nil {
+		t.Fatalf("expected err!")
+	}
+}
+
+func TestCreateDuplicateIDs(t *testing.T) {
+	conf := fastConf()
+	conf.IDGenerator = constIDGenerator(make([]byte, 20))
+	if _, err := Create(conf, nil); err == nil {
+		t.Fatalf("expected err!")
+	}
+
+	// Wrong length IDs are rejected
+	conf = fastConf()
+	conf.IDGenerator = constIDGenerator(make([]byte, 4))
+	if _, err := Create(conf, nil); err == nil {
+		t.Fatalf("expected err!")
+	}
+}
+
+func TestAddVnodesTokens(t *testing.T) {
+	r := makeRings(t, InitMLTransport(), 1, func(conf *Config) {
+		conf.IDGenerator = &TokenIDGenerator{Node: 0, Nodes: 2}
+	})[0]
+	defer r.Shutdown()
+
+	// Every token is taken
+	err := r.AddVnodes(1)
+	if err == nil || !strings.Contains(err.Error(), "token") {
+		t.Fatalf("expected token err. Got %v", err)
+	}
+
+	// Removed vnodes give their tokens back
+	if err := r.RemoveVnodes(2); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	waitStable(t, r)
+	if err := r.AddVnodes(3); err == nil {
+		t.Fatalf("expected err!")
+	}
+	if err := r.AddVnodes(2); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(r.Vnodes()) != r.config.NumVnodes {
+		t.Fatalf("expected %d vnodes, got %d", r.config.NumVnodes, len(r.Vnodes()))
+	}
+}
+
+func TestJoinIDCollision(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	conf.IDGenerator = TokenIDGenerator{Node: 0, Nodes: 2}
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Join with the same tokens
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	conf2.IDGenerator = TokenIDGenerator{Node: 0, Nodes: 2}
+	_, err = Join(conf2, ml, "test")
+	if _, ok := err.(*IDCollisionError); !ok {
+		t.Fatalf("expected collision err. Got %v", err)
+	}
+	_, err = JoinSeeds(conf2, ml, []string{"test"}, fastJoinOpts())
+	if _, ok := err.(*IDCollisionError); !ok {
+		t.Fatalf("expected collision err. Got %v", err)
+	}
+
+	// Distinct tokens join fine
+	conf2.IDGenerator = TokenIDGenerator{Node: 1, Nodes: 2}
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	r2.Shutdown()
+}
@@ -7,20 +7,53 @@ import (
 type closestPreceedingVnodeIterator struct {
 	key           []byte
 	vn            *localVnode
+	successors    []*Vnode
+	finger        []*Vnode
 	finger_idx    int
 	successor_idx int
 	yielded       map[string]struct{}
+	proximity     bool     // Yield from order, preferring nearby hosts
+	order         []*Vnode // Remaining candidates in proximity order
 }
 
 func (cp *closestPreceedingVnodeIterator) init(vn *localVnode, key []byte) {
+	// Iterate over a snapshot as the vnode may be stabilizing
+	vn.lock.RLock()
+	successors := make([]*Vnode, len(vn.successors))
+	copy(successors, vn.successors)
+	finger := make([]*Vnode, len(vn.finger))
+	copy(finger, vn.finger)
+	vn.lock.RUnlock()
+
+	cp.initWith(vn, key, successors, finger)
+}
+
+// Same as init but iterates over a snapshot of the routing state taken by the
+// caller, which may be shared by several iterators
+func (cp *closestPreceedingVnodeIterator) initWith(vn *localVnode, key []byte, successors, finger []*Vnode) {
 	cp.key = key
 	cp.vn = vn
-	cp.successor_idx = len(vn.successors) - 1
-	cp.finger_idx = len(vn.finger) - 1
+	cp.successors = successors
+	cp.finger = finger
+	cp.successor_idx = len(cp.successors) - 1
+	cp.finger_idx = len(cp.finger) - 1
 	cp.yielded = make(map[string]struct{})
+	if vn.ring.config.ProximityRouting {
+		cp.proximity = true
+		cp.order = cp.proximityOrder()
+	}
 }
 
 func (cp *closestPreceedingVnodeIterator) Next() *Vnode {
+	if cp.proximity {
+		if len(cp.order) == 0 {
+			return nil
+		}
+		next := cp.order[0]
+		cp.order = cp.order[1:]
+		return next
+	}
+
 	// Try to find each node
 	var successor_node *Vnode
 	var finger_node *Vnode
@@ -29,14 +62,14 @@ func (cp *closestPreceedingVnodeIterator) Next() *Vnode {
 	vn := cp.vn
 	var i int
 	for i = cp.successor_idx; i >= 0; i-- {
-		if vn.successors[i] == nil {
+		if cp.successors[i] == nil {
 			continue
 		}
-		if _, ok := cp.yielded[vn.successors[i].StringID()]; ok {
+		if _, ok := cp.yielded[cp.successors[i].StringID()]; ok {
 			continue
 		}
-		if between(vn.Id, cp.key, vn.successors[i].Id) {
-			successor_node = vn.successors[i]
+		if between(vn.Id, cp.key, cp.successors[i].Id) {
+			successor_node = cp.successors[i]
 			break
 		}
 	}
@@ -44,14 +77,14 @@ func (cp *closestPreceedingVnodeIterator) Next() *Vnode {
 
 	// Scan to find the next finger
 	for i = cp.finger_idx; i >= 0; i-- {
-		if vn.finger[i] == nil {
+		if cp.finger[i] == nil {
 			continue
 		}
-		if _, ok := cp.yielded[vn.finger[i].StringID()]; ok {
+		if _, ok := cp.yielded[cp.finger[i].StringID()]; ok {
 			continue
 		}
-		if between(vn.Id, cp.key, vn.finger[i].Id) {
-			finger_node = vn.finger[i]
+		if between(vn.Id, cp.key, cp.finger[i].Id) {
+			finger_node = cp.finger[i]
 			break
 		}
 	}
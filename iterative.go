@@ -0,0 +1,198 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// LookupMode selects how a lookup is routed around the ring
+type LookupMode int
+
+const (
+	// LookupRecursive has each vnode forward the lookup to the next hop
+	LookupRecursive LookupMode = iota
+	// LookupIterative has the ring starting the lookup contact every hop
+	// itself, asking each for the vnodes closest preceding the key
+	LookupIterative
+)
+
+func (m LookupMode) String() string {
+	switch m {
+	case LookupRecursive:
+		return "recursive"
+	case LookupIterative:
+		return "iterative"
+	}
+	return fmt.Sprintf("LookupMode(%d)", int(m))
+}
+
+// IterativeTransport can optionally be implemented by a Transport to support
+// iterative lookups.  Hops reached through a transport without it are looked
+// up recursively instead.
+type IterativeTransport interface {
+	// Returns the successors of a vnode and up to n of the vnodes it knows
+	// closest preceding the key, nearest to the key first
+	ClosestPreceding(ctx context.Context, vn *Vnode, n int, key []byte) ([]*Vnode, []*Vnode, error)
+}
+
+var errIterativeUnsupported = errors.New("transport does not support iterative lookups")
+
+// ClosestPreceding returns our known successors along with up to n of the
+// vnodes from our successors and finger table that precede the key, closest
+// to the key first.  It is the server side of a single iterative lookup hop.
+func (vn *localVnode) ClosestPreceding(ctx context.Context, n int, key []byte) ([]*Vnode, []*Vnode, error) {
+	succs := vn.successorList(true)
+	if len(succs) == 0 {
+		return nil, nil, errNoSuccessor
+	}
+
+	// No candidates needed if our successor owns the key
+	if betweenRightIncl(vn.Id, succs[0].Id, key) {
+		return succs, nil, nil
+	}
+
+	cp := closestPreceedingVnodeIterator{}
+	cp.init(vn, key)
+	closest := make([]*Vnode, 0, n)
+	for len(closest) < n {
+		next := cp.Next()
+		if next == nil {
+			break
+		}
+		closest = append(closest, next)
+	}
+	return succs, closest, nil
+}
+
+// A vnode contacted during an iterative lookup along with what it returned
+type iterativeHop struct {
+	vn      *Vnode
+	succs   []*Vnode
+	closest []*Vnode
+	done    bool // succs is the final result
+}
+
+// Looks up the successors of the key starting at the given vnode, using the
+// configured lookup mode
+func (r *Ring) findSuccessors(ctx context.Context, start *localVnode, n int, key []byte) ([]*Vnode, error) {
+	if r.config.LookupMode == LookupIterative {
+		return r.iterativeFindSuccessors(ctx, start, n, key)
+	}
+	return start.FindSuccessors(ctx, n, key)
+}
+
+// Walks the ring by asking each hop for the vnodes closest preceding the key
+// and contacting the nearest one next.  If a hop fails or times out the next
+// best candidate of the previous hop is tried, and once none is left the
+// successor list of that hop is checked, the same as a recursive lookup does.
+func (r *Ring) iterativeFindSuccessors(ctx context.Context, start *localVnode, n int, key []byte) ([]*Vnode, error) {
+	trace := traceFrom(ctx)
+	visited := map[string]bool{start.StringID(): true}
+
+	succs, closest, err := start.ClosestPreceding(ctx, r.config.NumSuccessors, key)
+	if err != nil {
+		return nil, err
+	}
+	path := []*iterativeHop{{vn: &start.Vnode, succs: succs, closest: closest}}
+
+	fallback := false
+	for len(path) > 0 {
+		cur := path[len(path)-1]
+
+		// Done if the successor of the hop owns the key
+		if cur.done || len(cur.succs) > 0 && betweenRightIncl(cur.vn.Id, cur.succs[0].Id, key) {
+			return firstN(cur.succs, n), nil
+		}
+
+		// Out of candidates, check the rest of the successor list
+		if len(cur.closest) == 0 {
+			for i := 1; i < len(cur.succs); i++ {
+				if betweenRightIncl(cur.vn.Id, cur.succs[i].Id, key) {
+					trace.end(trace.begin(cur.vn, true), time.Now(), nil)
+					return firstN(cur.succs[i:], n), nil
+				}
+			}
+			path = path[:len(path)-1]
+			continue
+		}
+
+		// Contact the nearest candidate
+		next := cur.closest[0]
+		cur.closest = cur.closest[1:]
+		if visited[next.StringID()] {
+			continue
+		}
+		visited[next.StringID()] = true
+
+		hop := trace.begin(next, fallback)
+		began := time.Now()
+		res, err := r.nextHops(ctx, next, n, key)
+		trace.end(hop, began, err)
+		if err != nil {
+			// Give up if the caller is no longer waiting
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("[ERR] Failed to contact %s. Got %s", next.StringID(), err)
+			fallback = true
+			continue
+		}
+		fallback = false
+		path = append(path, res)
+	}
+
+	// Checked all closer nodes and our successors!
+	return nil, fmt.Errorf("Exhausted all preceeding nodes!")
+}
+
+// Asks a vnode for its successors and closest preceding candidates within the
+// hop timeout.  Vnodes reached through a transport without iterative support
+// are asked to finish the lookup recursively.
+func (r *Ring) nextHops(ctx context.Context, vn *Vnode, n int, key []byte) (*iterativeHop, error) {
+	if r.config.HopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.HopTimeout)
+		defer cancel()
+	}
+
+	it, ok := r.transport.(IterativeTransport)
+	if ok {
+		succs, closest, err := it.ClosestPreceding(ctx, vn, r.config.NumSuccessors, key)
+		if err != errIterativeUnsupported {
+			return &iterativeHop{vn: vn, succs: dropNil(succs), closest: dropNil(closest)}, err
+		}
+	}
+
+	// Fall back to a recursive lookup from the vnode, which ends the walk
+	succs, err := r.transport.FindSuccessors(ctx, vn, n, key)
+	if err != nil {
+		return nil, err
+	}
+	if succs = dropNil(succs); len(succs) == 0 {
+		return nil, fmt.Errorf("successor vnodes not found")
+	}
+	return &iterativeHop{vn: vn, succs: succs, done: true}, nil
+}
+
+// Returns the vnodes that are not nil
+func dropNil(vnodes []*Vnode) []*Vnode {
+	out := make([]*Vnode, 0, len(vnodes))
+	for _, vn := range vnodes {
+		if vn != nil {
+			out = append(out, vn)
+		}
+	}
+	return out
+}
+
+// Returns up to the first n vnodes
+func firstN(vnodes []*Vnode, n int) []*Vnode {
+	if len(vnodes) > n {
+		return vnodes[:n]
+	}
+	return vnodes
+}
@@ -0,0 +1,147 @@
+package chord
+
+import (
+	"sort"
+	"testing"
+
+	context "golang.org/x/net/context"
+)
+
+// recursiveOnlyTrans hides the iterative support of a transport
+type recursiveOnlyTrans struct {
+	Transport
+}
+
+// Sets the lookup mode of a ring
+func lookupMode(mode LookupMode) func(*Config) {
+	return func(conf *Config) {
+		conf.LookupMode = mode
+	}
+}
+
+// Checks iterative lookups against the owner found in the sorted vnodes
+func checkIterativeLookups(t *testing.T, r, r2 *Ring) {
+	var all []*Vnode
+	for _, ring := range []*Ring{r, r2} {
+		for _, info := range ring.Vnodes() {
+			vn := info.Vnode
+			all = append(all, &vn)
+		}
+	}
+	sort.Sort(vnodeSlice(all))
+
+	keys := [][]byte{[]byte("test"), []byte("foo"), []byte("bar"), []byte("baz")}
+	for _, k := range keys {
+		kh, _, succs, err := r.Lookup(3, k)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		// The successors follow the nearest vnode preceding the key
+		exp := nearestVnodeToKey(all, kh)
+		idx := 0
+		for i, vn := range all {
+			if vn == exp {
+				idx = i
+			}
+		}
+		for i, succ := range succs {
+			if want := all[(idx+i+1)%len(all)]; succ.StringID() != want.StringID() {
+				t.Fatalf("bad successor %d for %s", i, k)
+			}
+		}
+	}
+}
+
+func TestLookupIterative(t *testing.T) {
+	rings := makeRings(t, InitMLTransport(), 2, lookupMode(LookupIterative))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	defer r2.Shutdown()
+	checkIterativeLookups(t, r, r2)
+
+	// Every hop is contacted by the starting ring
+	_, _, hops, err := r.LookupTrace([]byte("test"))
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	for _, hop := range hops {
+		if hop.Error != "" || hop.Fallback {
+			t.Fatalf("bad hop %v", hop)
+		}
+	}
+}
+
+func TestLookupIterativeUnsupported(t *testing.T) {
+	rings := makeRings(t, &recursiveOnlyTrans{InitMLTransport()}, 2, lookupMode(LookupIterative))
+	r, r2 := rings[0], rings[1]
+	defer r.Shutdown()
+	defer r2.Shutdown()
+	checkIterativeLookups(t, r, r2)
+}
+
+// Kill off a part of the ring and see what happens
+func TestVnodeIterativeSomeDead(t *testing.T) {
+	r := makeRing()
+	r.config.LookupMode = LookupIterative
+	sort.Sort(r)
+	num := len(r.vnodes)
+	for i := 0; i < num; i++ {
+		r.vnodes[i].successors[0] = &r.vnodes[(i+1)%num].Vnode
+		r.vnodes[i].successors[1] = &r.vnodes[(i+2)%num].Vnode
+	}
+
+	// Kill 2 of the nodes
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[0].Vnode)
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[3].Vnode)
+
+	// Get a random key
+	h := r.config.HashFunc()
+	h.Write([]byte("test"))
+	key := h.Sum(nil)
+
+	// Local only, should be nearest in the ring
+	nearest := r.nearestVnode(key)
+	exp := nearest.successors[0]
+
+	// Do a lookup on the key
+	for i := 0; i < len(r.vnodes); i++ {
+		vn := r.vnodes[i]
+		succ, err := r.findSuccessors(context.Background(), vn, 1, key)
+		if err != nil {
+			t.Fatalf("(%d) unexpected err! %s", i, err)
+		}
+		if exp != succ[0] {
+			t.Fatalf("(%d) unexpected succ! K:%x Exp: %s Got:%s",
+				i, key, exp, succ[0])
+		}
+	}
+}
+
+func TestVnodeClosestPreceding(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	num := len(r.vnodes)
+	for i := 0; i < num; i++ {
+		r.vnodes[i].successors[0] = &r.vnodes[(i+1)%num].Vnode
+		r.vnodes[i].successors[1] = &r.vnodes[(i+2)%num].Vnode
+	}
+	vn := r.vnodes[0]
+
+	// Our successor owns its own ID
+	succs, closest, err := vn.ClosestPreceding(context.Background(), 3, r.vnodes[1].Id)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if len(succs) != 2 || len(closest) != 0 {
+		t.Fatalf("bad next hops %v %v", succs, closest)
+	}
+
+	// Candidates are closest to the key first
+	_, closest, err = vn.ClosestPreceding(context.Background(), 3, r.vnodes[3].Id)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if len(closest) != 2 || closest[0] != &r.vnodes[2].Vnode || closest[1] != &r.vnodes[1].Vnode {
+		t.Fatalf("bad candidates %v", closest)
+	}
+}
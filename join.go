@@ -0,0 +1,221 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// JoinOptions controls how JoinSeeds retries the seed hosts
+type JoinOptions struct {
+	Timeout        time.Duration // Give up joining after this long
+	InitialBackoff time.Duration // Wait before the first retry round
+	MaxBackoff     time.Duration // Upper bound of the wait between rounds
+}
+
+// DefaultJoinOptions returns the default JoinSeeds options
+func DefaultJoinOptions() *JoinOptions {
+	return &JoinOptions{
+		Timeout:        time.Duration(30 * time.Second),
+		InitialBackoff: time.Duration(100 * time.Millisecond),
+		MaxBackoff:     time.Duration(5 * time.Second),
+	}
+}
+
+// Returns a copy of the options with the unset ones taken from
+// DefaultJoinOptions
+func (o *JoinOptions) withDefaults() *JoinOptions {
+	def := DefaultJoinOptions()
+	if o == nil {
+		return def
+	}
+	opts := *o
+	if opts.Timeout <= 0 {
+		opts.Timeout = def.Timeout
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = def.InitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = def.MaxBackoff
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		opts.MaxBackoff = opts.InitialBackoff
+	}
+	return &opts
+}
+
+// JoinAttempt describes a single failed call made while joining
+type JoinAttempt struct {
+	Round int    // Retry round, starting at 1
+	Seed  string // Seed host the call went to
+	Vnode *Vnode // Remote vnode queried, nil when listing the seed's vnodes
+	Local *Vnode // Local vnode being placed, nil when listing the seed's vnodes
+	Err   error  // Why the call failed
+}
+
+func (a *JoinAttempt) String() string {
+	if a.Vnode == nil {
+		return fmt.Sprintf("round %d: list vnodes on %s: %s", a.Round, a.Seed, a.Err)
+	}
+	return fmt.Sprintf("round %d: find successors of %s via %s/%s: %s",
+		a.Round, a.Local.StringID(), a.Seed, a.Vnode.StringID(), a.Err)
+}
+
+// JoinError is returned by JoinSeeds when none of the seeds could be used to
+// place every local vnode before the timeout.
+type JoinError struct {
+	Attempts []*JoinAttempt
+}
+
+func (e *JoinError) Error() string {
+	lines := make([]string, 0, len(e.Attempts)+1)
+	lines = append(lines, fmt.Sprintf("failed to join ring after %d failed calls", len(e.Attempts)))
+	for _, a := range e.Attempts {
+		lines = append(lines, a.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// JoinSeeds joins an existing Chord ring through any of the given seed hosts.
+// The seeds are tried in random order and failed rounds are retried with
+// exponential backoff and jitter until opts.Timeout passes.  Each local vnode
+// falls back to the vnodes of the other seeds if its lookup fails.  If opts is
+// nil DefaultJoinOptions is used, and unset options take their default.
+func JoinSeeds(conf *Config, trans Transport, seeds []string, opts *JoinOptions) (*Ring, error) {
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no seed hosts given")
+	}
+	opts = opts.withDefaults()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	// Initialize the hash bits
+	conf.hashBits = conf.HashFunc().Size() * 8
+
+	// Create a ring
+	ring := &Ring{}
+	if err := ring.init(conf, trans); err != nil {
+		return nil, err
+	}
+
+	var (
+		jerr    = &JoinError{}
+		placed  = make([]bool, len(ring.vnodes))
+		backoff = opts.InitialBackoff
+	)
+	for round := 1; ; round++ {
+		done, err := ring.joinRound(ctx, round, shuffleSeeds(seeds), placed, jerr)
+		if err != nil {
+			ring.deregisterVnodes()
+			return nil, err
+		}
+		if done {
+			break
+		}
+
+		// Wait for the next round
+		select {
+		case <-ctx.Done():
+			ring.deregisterVnodes()
+			return nil, jerr
+		case <-time.After(jitter(backoff)):
+		}
+		if backoff *= 2; backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+
+	ring.startJoined()
+	return ring, nil
+}
+
+// Makes one pass over the seeds trying to place every vnode that has no
+// successors yet.  Returns true once all the vnodes are placed, or an error if
+// a vnode ID is already taken, which retrying cannot fix.
+func (r *Ring) joinRound(ctx context.Context, round int, seeds []string, placed []bool, jerr *JoinError) (bool, error) {
+	// Request a list of vnodes from every seed
+	seedVnodes := make(map[string][]*Vnode, len(seeds))
+	for _, seed := range seeds {
+		vnodes, err := r.transport.ListVnodes(ctx, seed)
+		if err == nil && len(vnodes) == 0 {
+			err = fmt.Errorf("remote host has no vnodes")
+		}
+		if err != nil {
+			jerr.Attempts = append(jerr.Attempts, &JoinAttempt{Round: round, Seed: seed, Err: err})
+			continue
+		}
+		if err := r.checkRemoteCollision(vnodes); err != nil {
+			return false, err
+		}
+		sort.Sort(vnodeSlice(vnodes))
+		seedVnodes[seed] = vnodes
+	}
+
+	// Acquire a live successor for each vnode
+	done := true
+	for idx, vn := range r.vnodes {
+		if placed[idx] {
+			continue
+		}
+		for _, seed := range seeds {
+			vnodes, ok := seedVnodes[seed]
+			if !ok {
+				continue
+			}
+
+			// Query the nearest vnode of the seed for the successors
+			nearest := nearestVnodeToKey(vnodes, vn.Id)
+			succs, err := r.transport.FindSuccessors(ctx, nearest, r.config.NumSuccessors, vn.Id)
+			if err == nil && len(succs) == 0 {
+				err = fmt.Errorf("successor vnodes not found")
+			}
+			if err != nil {
+				jerr.Attempts = append(jerr.Attempts, &JoinAttempt{
+					Round: round, Seed: seed, Vnode: nearest, Local: &vn.Vnode, Err: err,
+				})
+				continue
+			}
+			if err := checkCollision(&vn.Vnode, succs); err != nil {
+				return false, err
+			}
+
+			vn.setSuccessors(succs)
+			placed[idx] = true
+			break
+		}
+		done = done && placed[idx]
+	}
+	return done, nil
+}
+
+// Returns a shuffled copy of the seeds
+func shuffleSeeds(seeds []string) []string {
+	out := make([]string, len(seeds))
+	for i, j := range rand.Perm(len(seeds)) {
+		out[i] = seeds[j]
+	}
+	return out
+}
+
+// Returns a random duration in [d/2, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+// vnodeSlice sorts vnodes by their ID
+type vnodeSlice []*Vnode
+
+func (vs vnodeSlice) Len() int           { return len(vs) }
+func (vs vnodeSlice) Less(i, j int) bool { return bytes.Compare(vs[i].Id, vs[j].Id) == -1 }
+func (vs vnodeSlice) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
@@ -0,0 +1,150 @@
+package chord
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func fastJoinOpts() *JoinOptions {
+	return &JoinOptions{
+		Timeout:        time.Duration(500 * time.Millisecond),
+		InitialBackoff: time.Duration(10 * time.Millisecond),
+		MaxBackoff:     time.Duration(40 * time.Millisecond),
+	}
+}
+
+func TestJoinSeeds(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	// Join through a list with dead seeds
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := JoinSeeds(conf2, ml, []string{"dead1", "test", "dead2"}, fastJoinOpts())
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+
+	for _, vn := range r2.vnodes {
+		if vn.successor() == nil {
+			t.Fatalf("vnode without successor")
+		}
+	}
+
+	// Shutdown
+	r.Shutdown()
+	r2.Shutdown()
+}
+
+func TestJoinSeedsRetry(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Bring the seed up only after the first attempts failed
+	var r *Ring
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		<-time.After(50 * time.Millisecond)
+		r, _ = Create(fastConf(), ml)
+	}()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := JoinSeeds(conf2, ml, []string{"test"}, fastJoinOpts())
+	<-started
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+
+	// Shutdown
+	r.Shutdown()
+	r2.Shutdown()
+}
+
+func TestJoinSeedsAllDead(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	conf := fastConf()
+	start := time.Now()
+	_, err := JoinSeeds(conf, ml, []string{"dead1", "dead2"}, fastJoinOpts())
+	if err == nil {
+		t.Fatalf("expected err!")
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Fatalf("gave up before the timeout")
+	}
+
+	jerr, ok := err.(*JoinError)
+	if !ok {
+		t.Fatalf("expected a JoinError. Got %T", err)
+	}
+	if len(jerr.Attempts) < 4 {
+		t.Fatalf("expected multiple rounds. Got %d attempts", len(jerr.Attempts))
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "dead1") || !strings.Contains(msg, "dead2") {
+		t.Fatalf("error does not list every seed: %s", msg)
+	}
+}
+
+func TestJoinSeedsNoSeeds(t *testing.T) {
+	ml := InitMLTransport()
+	if _, err := JoinSeeds(fastConf(), ml, nil, nil); err == nil {
+		t.Fatalf("expected err!")
+	}
+}
+
+func TestJoinSeedsZeroOptions(t *testing.T) {
+	ml := InitMLTransport()
+	r, err := Create(fastConf(), ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Unset options take their default
+	opts := &JoinOptions{}
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := JoinSeeds(conf2, ml, []string{"test"}, opts)
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	if *opts != (JoinOptions{}) {
+		t.Fatalf("options were modified: %+v", opts)
+	}
+
+	// A zero backoff does not retry in a tight loop
+	conf3 := fastConf()
+	conf3.Hostname = "test3"
+	_, err = JoinSeeds(conf3, ml, []string{"dead"}, &JoinOptions{Timeout: 300 * time.Millisecond})
+	jerr, ok := err.(*JoinError)
+	if !ok {
+		t.Fatalf("expected a JoinError. Got %v", err)
+	}
+	if len(jerr.Attempts) > 10 {
+		t.Fatalf("retried too fast. Got %d attempts", len(jerr.Attempts))
+	}
+}
+
+func TestJoinOptionsDefaults(t *testing.T) {
+	def := DefaultJoinOptions()
+	if opts := (*JoinOptions)(nil).withDefaults(); *opts != *def {
+		t.Fatalf("bad options %+v", opts)
+	}
+	opts := (&JoinOptions{InitialBackoff: 10 * time.Second}).withDefaults()
+	if opts.Timeout != def.Timeout || opts.MaxBackoff != 10*time.Second {
+		t.Fatalf("bad options %+v", opts)
+	}
+}
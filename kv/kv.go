@@ -0,0 +1,238 @@
+// Package kv is a replicated key/value store built on a chord ring.  Each key
+// is stored on the first distinct hosts of the successors of its hash, as
+// returned by Ring.LookupN.
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	chord "github.com/ipkg/go-chord"
+	context "golang.org/x/net/context"
+)
+
+// ErrNotFound is returned by Get when no replica has the key
+var ErrNotFound = errors.New("key not found")
+
+// Config is used to configure a Store
+type Config struct {
+	Replicas int     // Number of hosts each key is written to
+	Storage  Storage // Storage of the local host, in memory if nil
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Replicas: 3,
+	}
+}
+
+// Store is a key/value store replicating each key to the hosts of the first
+// successors of its hash.  Writes go to every replica and succeed once all of
+// them do.  Reads try the replicas in ring order and return the first copy
+// found.
+type Store struct {
+	ring    *chord.Ring
+	trans   Transport
+	conf    *Config
+	host    string
+	storage Storage
+	lock    sync.Mutex
+	short   bool // Fewer hosts than replicas on the last lookup
+}
+
+// New creates a Store on a ring and registers the local storage with the
+// transport.
+func New(ring *chord.Ring, trans Transport, conf *Config) (*Store, error) {
+	if conf.Replicas <= 0 {
+		return nil, fmt.Errorf("number of replicas must be positive")
+	}
+	vnodes := ring.Vnodes()
+	if len(vnodes) == 0 {
+		return nil, fmt.Errorf("ring has no local vnodes")
+	}
+
+	s := &Store{
+		ring:    ring,
+		trans:   trans,
+		conf:    conf,
+		host:    vnodes[0].Vnode.Host,
+		storage: conf.Storage,
+	}
+	if s.storage == nil {
+		s.storage = NewMemoryStorage()
+	}
+	trans.Register(s.host, s.storage)
+	return s, nil
+}
+
+// Storage returns the storage of the local host
+func (s *Store) Storage() Storage {
+	return s.storage
+}
+
+// Get returns the value of a key
+func (s *Store) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get but the context is passed through to the
+// lookup and the replicas.
+func (s *Store) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	hosts, err := s.replicas(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask the replicas in order, skipping the failed ones
+	var (
+		answered bool
+		lastErr  error
+	)
+	for _, host := range hosts {
+		value, found, err := s.get(ctx, host, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if found {
+			return value, nil
+		}
+		answered = true
+	}
+
+	// Only report a missing key if a replica said so
+	if !answered {
+		return nil, lastErr
+	}
+	return nil, ErrNotFound
+}
+
+// Put sets the value of a key on every replica
+func (s *Store) Put(key, value []byte) error {
+	return s.PutContext(context.Background(), key, value)
+}
+
+// PutContext is the same as Put but the context is passed through to the
+// lookup and the replicas.
+func (s *Store) PutContext(ctx context.Context, key, value []byte) error {
+	return s.write(ctx, key, func(host string) error {
+		if host == s.host {
+			return s.storage.Put(key, value)
+		}
+		return s.trans.Put(ctx, host, key, value)
+	})
+}
+
+// Delete removes a key from every replica
+func (s *Store) Delete(key []byte) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is the same as Delete but the context is passed through to
+// the lookup and the replicas.
+func (s *Store) DeleteContext(ctx context.Context, key []byte) error {
+	return s.write(ctx, key, func(host string) error {
+		if host == s.host {
+			return s.storage.Delete(key)
+		}
+		return s.trans.Delete(ctx, host, key)
+	})
+}
+
+// Returns the hosts of the replicas of a key in ring order.  Vnodes on the
+// same host share its storage, so each host is listed once and the walk past
+// the key goes on until it finds enough hosts.  A ring with fewer hosts than
+// replicas uses all of them.
+func (s *Store) replicas(ctx context.Context, key []byte) ([]string, error) {
+	var hosts []string
+	for n := s.conf.Replicas; ; n *= 2 {
+		_, succs, err := s.ring.LookupNContext(ctx, n, key)
+		if err != nil {
+			return nil, err
+		}
+		hosts = make([]string, 0, s.conf.Replicas)
+		seen := make(map[string]bool, s.conf.Replicas)
+		for _, vn := range succs {
+			if vn == nil || seen[vn.Host] {
+				continue
+			}
+			seen[vn.Host] = true
+			hosts = append(hosts, vn.Host)
+			if len(hosts) == s.conf.Replicas {
+				s.setShort(false)
+				return hosts, nil
+			}
+		}
+
+		// Fewer vnodes than asked for means the walk went around the ring
+		if len(succs) < n {
+			break
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no replicas found")
+	}
+	if !s.setShort(true) {
+		log.Printf("[ERR] Ring has %d hosts, keys are written to fewer than %d replicas",
+			len(hosts), s.conf.Replicas)
+	}
+	return hosts, nil
+}
+
+// Records whether the ring has fewer hosts than replicas, returning the
+// previous value so the shortage is only logged when it starts
+func (s *Store) setShort(short bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	prev := s.short
+	s.short = short
+	return prev
+}
+
+// Reads a key from a replica
+func (s *Store) get(ctx context.Context, host string, key []byte) ([]byte, bool, error) {
+	if host == s.host {
+		return s.storage.Get(key)
+	}
+	return s.trans.Get(ctx, host, key)
+}
+
+// Applies a write to every replica of a key in parallel
+func (s *Store) write(ctx context.Context, key []byte, f func(host string) error) error {
+	hosts, err := s.replicas(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if e := f(host); e != nil {
+				lock.Lock()
+				err = mergeErrors(err, fmt.Errorf("failed to write to %s: %s", host, e))
+				lock.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+	return err
+}
+
+// Merges two errors together
+func mergeErrors(err1, err2 error) error {
+	if err1 == nil {
+		return err2
+	} else if err2 == nil {
+		return err1
+	} else {
+		return fmt.Errorf("%s\n%s", err1, err2)
+	}
+}
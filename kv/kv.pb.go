@@ -0,0 +1,272 @@
+// Code generated by protoc-gen-go.
+// source: kv.proto
+// DO NOT EDIT!
+
+/*
+Package kv is a generated protocol buffer package.
+
+It is generated from these files:
+	kv.proto
+
+It has these top-level messages:
+	Key
+	Value
+	Pair
+	Empty
+*/
+package kv
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Key struct {
+	Key []byte `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+}
+
+func (m *Key) Reset()                    { *m = Key{} }
+func (m *Key) String() string            { return proto.CompactTextString(m) }
+func (*Key) ProtoMessage()               {}
+func (*Key) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Key) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+type Value struct {
+	Value []byte `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Found bool   `protobuf:"varint,2,opt,name=found" json:"found,omitempty"`
+}
+
+func (m *Value) Reset()                    { *m = Value{} }
+func (m *Value) String() string            { return proto.CompactTextString(m) }
+func (*Value) ProtoMessage()               {}
+func (*Value) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Value) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *Value) GetFound() bool {
+	if m != nil {
+		return m.Found
+	}
+	return false
+}
+
+type Pair struct {
+	Key   []byte `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Pair) Reset()                    { *m = Pair{} }
+func (m *Pair) String() string            { return proto.CompactTextString(m) }
+func (*Pair) ProtoMessage()               {}
+func (*Pair) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Pair) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *Pair) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type Empty struct {
+}
+
+func (m *Empty) Reset()                    { *m = Empty{} }
+func (m *Empty) String() string            { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()               {}
+func (*Empty) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func init() {
+	proto.RegisterType((*Key)(nil), "kv.Key")
+	proto.RegisterType((*Value)(nil), "kv.Value")
+	proto.RegisterType((*Pair)(nil), "kv.Pair")
+	proto.RegisterType((*Empty)(nil), "kv.Empty")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Kv service
+
+type KvClient interface {
+	GetServe(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Value, error)
+	PutServe(ctx context.Context, in *Pair, opts ...grpc.CallOption) (*Empty, error)
+	DeleteServe(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type kvClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewKvClient(cc *grpc.ClientConn) KvClient {
+	return &kvClient{cc}
+}
+
+func (c *kvClient) GetServe(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Value, error) {
+	out := new(Value)
+	err := grpc.Invoke(ctx, "/kv.kv/GetServe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvClient) PutServe(ctx context.Context, in *Pair, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/kv.kv/PutServe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvClient) DeleteServe(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/kv.kv/DeleteServe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Kv service
+
+type KvServer interface {
+	GetServe(context.Context, *Key) (*Value, error)
+	PutServe(context.Context, *Pair) (*Empty, error)
+	DeleteServe(context.Context, *Key) (*Empty, error)
+}
+
+func RegisterKvServer(s *grpc.Server, srv KvServer) {
+	s.RegisterService(&_Kv_serviceDesc, srv)
+}
+
+func _Kv_GetServe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvServer).GetServe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.kv/GetServe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvServer).GetServe(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kv_PutServe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pair)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvServer).PutServe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.kv/PutServe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvServer).PutServe(ctx, req.(*Pair))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kv_DeleteServe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvServer).DeleteServe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.kv/DeleteServe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvServer).DeleteServe(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Kv_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "kv.kv",
+	HandlerType: (*KvServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetServe",
+			Handler:    _Kv_GetServe_Handler,
+		},
+		{
+			MethodName: "PutServe",
+			Handler:    _Kv_PutServe_Handler,
+		},
+		{
+			MethodName: "DeleteServe",
+			Handler:    _Kv_DeleteServe_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "kv.proto",
+}
+
+func init() { proto.RegisterFile("kv.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 182 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xc8, 0x2e, 0xd3, 0x2b,
+	0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0xca, 0x2e, 0x53, 0x12, 0xe2, 0x62, 0xf6, 0x4e, 0xad, 0x14,
+	0xe2, 0xe6, 0x62, 0xce, 0x4e, 0xad, 0x94, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x51, 0x52, 0xe5, 0x62,
+	0x0d, 0x4b, 0xcc, 0x29, 0x4d, 0x15, 0xe2, 0xe5, 0x62, 0x2d, 0x03, 0x31, 0x20, 0xe2, 0x20, 0x6e,
+	0x5a, 0x7e, 0x69, 0x5e, 0x8a, 0x04, 0x93, 0x02, 0xa3, 0x06, 0x87, 0x92, 0x12, 0x17, 0x4b, 0x40,
+	0x62, 0x66, 0x11, 0x8a, 0x5e, 0x84, 0x16, 0x26, 0xb0, 0x51, 0xec, 0x5c, 0xac, 0xae, 0xb9, 0x05,
+	0x25, 0x95, 0x46, 0x79, 0x5c, 0x4c, 0xd9, 0x65, 0x42, 0x0a, 0x5c, 0x1c, 0xee, 0xa9, 0x25, 0xc1,
+	0xa9, 0x45, 0x65, 0xa9, 0x42, 0xec, 0x7a, 0xd9, 0x65, 0x7a, 0xde, 0xa9, 0x95, 0x52, 0x9c, 0x20,
+	0x06, 0xd8, 0x42, 0x25, 0x06, 0x21, 0x45, 0x2e, 0x8e, 0x80, 0x52, 0xa8, 0x0a, 0x0e, 0x90, 0x04,
+	0xc8, 0x0a, 0x88, 0x12, 0xb0, 0x41, 0x4a, 0x0c, 0x42, 0xca, 0x5c, 0xdc, 0x2e, 0xa9, 0x39, 0xa9,
+	0x25, 0xa9, 0xd8, 0xcc, 0x81, 0x2a, 0x4a, 0x62, 0x03, 0x7b, 0xd1, 0x18, 0x30, 0x00, 0xac, 0x9a,
+	0xda, 0xf6, 0xee, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,325 @@
+package kv
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	chord "github.com/ipkg/go-chord"
+	"google.golang.org/grpc"
+)
+
+func fastConf(hostname string) *chord.Config {
+	conf := chord.DefaultConfig(hostname)
+	conf.StabilizeMin = time.Duration(15 * time.Millisecond)
+	conf.StabilizeMax = time.Duration(45 * time.Millisecond)
+	return conf
+}
+
+func TestMemoryStorage(t *testing.T) {
+	m := NewMemoryStorage()
+	if _, found, err := m.Get([]byte("foo")); err != nil || found {
+		t.Fatalf("unexpected key")
+	}
+
+	// The value is copied
+	value := []byte("bar")
+	if err := m.Put([]byte("foo"), value); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	value[0] = 'c'
+	out, found, err := m.Get([]byte("foo"))
+	if err != nil || !found || string(out) != "bar" {
+		t.Fatalf("bad value %s", out)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected 1 key")
+	}
+
+	if err := m.Delete([]byte("foo")); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if _, found, _ := m.Get([]byte("foo")); found {
+		t.Fatalf("key should be deleted")
+	}
+	if err := m.Delete([]byte("foo")); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+}
+
+func TestStoreLocal(t *testing.T) {
+	r, err := chord.Create(fastConf("test"), nil)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	s, err := New(r, NewLocalTransport(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	if _, err := s.Get([]byte("foo")); err != ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := s.Put([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	value, err := s.Get([]byte("foo"))
+	if err != nil || string(value) != "bar" {
+		t.Fatalf("bad value %s %v", value, err)
+	}
+	if err := s.Delete([]byte("foo")); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if _, err := s.Get([]byte("foo")); err != ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestStoreBadConfig(t *testing.T) {
+	r, err := chord.Create(fastConf("test"), nil)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	if _, err := New(r, NewLocalTransport(), &Config{}); err == nil {
+		t.Fatalf("expected err!")
+	}
+
+	// More replicas than hosts write to every host
+	s, err := New(r, NewLocalTransport(), &Config{Replicas: 9})
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if err := s.Put([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if value, err := s.Get([]byte("foo")); err != nil || string(value) != "bar" {
+		t.Fatalf("bad value %s %v", value, err)
+	}
+}
+
+// Creates a ring serving the chord and key/value RPCs on the same grpc server
+func prepStoreGrpc(t *testing.T, port int, existing string) (*chord.Ring, *Store, func()) {
+	return prepStoreGrpcConf(t, port, existing, nil, DefaultConfig())
+}
+
+// Same as prepStoreGrpc, with the ring config adjusted by setup
+func prepStoreGrpcConf(t *testing.T, port int, existing string, setup func(*chord.Config), kvConf *Config) (*chord.Ring, *Store, func()) {
+	listen := fmt.Sprintf("127.0.0.1:%d", port)
+	conf := fastConf(listen)
+	if setup != nil {
+		setup(conf)
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	gserver := grpc.NewServer()
+	trans := chord.NewGRPCTransport(gserver, 2*time.Second, 300*time.Second)
+	kvTrans := NewGRPCTransport(gserver, 2*time.Second)
+	go gserver.Serve(ln)
+
+	var r *chord.Ring
+	if existing == "" {
+		r, err = chord.Create(conf, trans)
+	} else {
+		r, err = chord.Join(conf, trans, existing)
+	}
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	s, err := New(r, kvTrans, kvConf)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	return r, s, func() {
+		r.Shutdown()
+		kvTrans.Shutdown()
+		trans.Shutdown()
+	}
+}
+
+func TestStoreGRPC(t *testing.T) {
+	r1, s1, stop1 := prepStoreGrpc(t, 20037, "")
+	defer stop1()
+	r2, s2, stop2 := prepStoreGrpc(t, 20038, "127.0.0.1:20037")
+	defer stop2()
+
+	// Wait for both rings to agree on the replicas
+	keys := make([][]byte, 20)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	for i := 0; ; i++ {
+		if agree(r1, r2, keys) {
+			break
+		}
+		if i == 500 {
+			t.Fatalf("rings do not agree")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, k := range keys {
+		if err := s1.Put(k, k); err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+	}
+
+	// Every key is readable from the other host, and stored on each replica
+	for _, k := range keys {
+		value, err := s2.Get(k)
+		if err != nil || !bytes.Equal(value, k) {
+			t.Fatalf("bad value for %s: %s %v", k, value, err)
+		}
+
+		_, _, succs, err := r1.Lookup(3, k)
+		if err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+		for _, vn := range succs {
+			storage := s1.Storage()
+			if vn.Host == "127.0.0.1:20038" {
+				storage = s2.Storage()
+			}
+			if _, found, _ := storage.Get(k); !found {
+				t.Fatalf("replica %s is missing %s", vn.Host, k)
+			}
+		}
+	}
+
+	// Deleting from the other host removes every copy
+	for _, k := range keys {
+		if err := s2.Delete(k); err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+	}
+	if n := s1.Storage().(*MemoryStorage).Len() + s2.Storage().(*MemoryStorage).Len(); n != 0 {
+		t.Fatalf("expected no keys, got %d", n)
+	}
+}
+
+func TestStoreGRPCFewSuccessors(t *testing.T) {
+	// Every host has more vnodes than successors
+	setup := func(conf *chord.Config) {
+		conf.NumSuccessors = 2
+	}
+	kvConf := &Config{Replicas: 2}
+	var (
+		rings  []*chord.Ring
+		stores []*Store
+	)
+	for i, port := range []int{20039, 20040, 20041} {
+		existing := ""
+		if i > 0 {
+			existing = "127.0.0.1:20039"
+		}
+		r, s, stop := prepStoreGrpcConf(t, port, existing, setup, kvConf)
+		defer stop()
+		rings = append(rings, r)
+		stores = append(stores, s)
+	}
+	for i := 0; !linked(rings); i++ {
+		if i == 500 {
+			t.Fatalf("rings are not linked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Each key is written to two distinct hosts
+	for i := 0; i < 20; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		if err := stores[0].Put(k, k); err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+		copies := 0
+		for _, s := range stores {
+			if _, found, _ := s.Storage().Get(k); found {
+				copies++
+			}
+		}
+		if copies != 2 {
+			t.Fatalf("expected 2 copies of %s, got %d", k, copies)
+		}
+	}
+}
+
+// Checks if every vnode of the rings has its true predecessor and successors
+func linked(rings []*chord.Ring) bool {
+	var infos []*chord.VnodeInfo
+	for _, r := range rings {
+		infos = append(infos, r.Vnodes()...)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return bytes.Compare(infos[i].Vnode.Id, infos[j].Vnode.Id) < 0
+	})
+
+	num := len(infos)
+	for i, info := range infos {
+		pred := infos[(i+num-1)%num].Vnode
+		if info.Predecessor == nil || !bytes.Equal(info.Predecessor.Id, pred.Id) {
+			return false
+		}
+		if len(info.Successors) == 0 {
+			return false
+		}
+		for j, succ := range info.Successors {
+			if !bytes.Equal(succ.Id, infos[(i+j+1)%num].Vnode.Id) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Checks if both rings find the true replicas of the keys, the first vnodes
+// at or past their hash.  Agreeing alone is not enough, the rings may agree
+// on replicas they are still stabilizing away from.
+func agree(r1, r2 *chord.Ring, keys [][]byte) bool {
+	var vnodes []*chord.Vnode
+	for _, r := range []*chord.Ring{r1, r2} {
+		for _, info := range r.Vnodes() {
+			vnodes = append(vnodes, &info.Vnode)
+		}
+	}
+
+	ring := new(big.Int).Lsh(big.NewInt(1), 160)
+	for _, k := range keys {
+		hash := sha1.Sum(k)
+		key := new(big.Int).SetBytes(hash[:])
+
+		// Order the vnodes by their distance past the key
+		dist := make(map[*chord.Vnode]*big.Int, len(vnodes))
+		for _, vn := range vnodes {
+			d := new(big.Int).Sub(new(big.Int).SetBytes(vn.Id), key)
+			dist[vn] = d.Mod(d, ring)
+		}
+		expect := make([]*chord.Vnode, len(vnodes))
+		copy(expect, vnodes)
+		sort.Slice(expect, func(i, j int) bool {
+			return dist[expect[i]].Cmp(dist[expect[j]]) < 0
+		})
+
+		for _, r := range []*chord.Ring{r1, r2} {
+			_, _, succs, err := r.Lookup(3, k)
+			if err != nil || len(succs) != 3 {
+				return false
+			}
+			for i := range succs {
+				if !bytes.Equal(succs[i].Id, expect[i].Id) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package kv
+
+import (
+	"sync"
+)
+
+// Storage holds the keys replicated to a host.  Implementations must be safe
+// for concurrent use.
+type Storage interface {
+	// Get returns the value of a key and whether it was found
+	Get(key []byte) ([]byte, bool, error)
+	// Put sets the value of a key
+	Put(key, value []byte) error
+	// Delete removes a key, deleting a missing key is not an error
+	Delete(key []byte) error
+}
+
+// MemoryStorage is a Storage keeping the keys in memory
+type MemoryStorage struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: make(map[string][]byte)}
+}
+
+// Get returns a copy of the value of a key
+func (m *MemoryStorage) Get(key []byte) ([]byte, bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	return copyBytes(value), true, nil
+}
+
+// Put stores a copy of the value of a key
+func (m *MemoryStorage) Put(key, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data[string(key)] = copyBytes(value)
+	return nil
+}
+
+// Delete removes a key
+func (m *MemoryStorage) Delete(key []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.data, string(key))
+	return nil
+}
+
+// Len returns the number of keys stored
+func (m *MemoryStorage) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.data)
+}
+
+// Returns a copy of a byte slice
+func copyBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
@@ -0,0 +1,225 @@
+package kv
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Transport carries the replica operations to the storage of other hosts
+type Transport interface {
+	// Register serves the storage of a local host
+	Register(host string, storage Storage)
+	// Get reads a key from a host, returning whether it was found
+	Get(ctx context.Context, host string, key []byte) ([]byte, bool, error)
+	// Put writes a key to a host
+	Put(ctx context.Context, host string, key, value []byte) error
+	// Delete removes a key from a host
+	Delete(ctx context.Context, host string, key []byte) error
+}
+
+// LocalTransport connects stores running in the same process, keyed by their
+// host name
+type LocalTransport struct {
+	lock  sync.RWMutex
+	hosts map[string]Storage
+}
+
+// NewLocalTransport returns a LocalTransport with no hosts registered
+func NewLocalTransport() *LocalTransport {
+	return &LocalTransport{hosts: make(map[string]Storage)}
+}
+
+// Register adds the storage of a host
+func (lt *LocalTransport) Register(host string, storage Storage) {
+	lt.lock.Lock()
+	lt.hosts[host] = storage
+	lt.lock.Unlock()
+}
+
+// Deregister removes a host
+func (lt *LocalTransport) Deregister(host string) {
+	lt.lock.Lock()
+	delete(lt.hosts, host)
+	lt.lock.Unlock()
+}
+
+func (lt *LocalTransport) get(host string) (Storage, error) {
+	lt.lock.RLock()
+	defer lt.lock.RUnlock()
+	storage, ok := lt.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("unknown host: %s", host)
+	}
+	return storage, nil
+}
+
+// Get reads a key from the storage of a host
+func (lt *LocalTransport) Get(ctx context.Context, host string, key []byte) ([]byte, bool, error) {
+	storage, err := lt.get(host)
+	if err != nil {
+		return nil, false, err
+	}
+	return storage.Get(key)
+}
+
+// Put writes a key to the storage of a host
+func (lt *LocalTransport) Put(ctx context.Context, host string, key, value []byte) error {
+	storage, err := lt.get(host)
+	if err != nil {
+		return err
+	}
+	return storage.Put(key, value)
+}
+
+// Delete removes a key from the storage of a host
+func (lt *LocalTransport) Delete(ctx context.Context, host string, key []byte) error {
+	storage, err := lt.get(host)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(key)
+}
+
+// GRPCTransport serves the replica operations on the gRPC server used by the
+// chord GRPCTransport, and sends them to the other hosts over gRPC
+type GRPCTransport struct {
+	lock     sync.RWMutex
+	storage  Storage
+	connLock sync.Mutex
+	conns    map[string]*grpc.ClientConn
+	shutdown bool
+	timeout  time.Duration
+}
+
+// NewGRPCTransport registers the key/value service on the grpc server.  Each
+// call to another host is bounded by the timeout.
+func NewGRPCTransport(gserver *grpc.Server, rpcTimeout time.Duration) *GRPCTransport {
+	gt := &GRPCTransport{
+		conns:   map[string]*grpc.ClientConn{},
+		timeout: rpcTimeout,
+	}
+	RegisterKvServer(gserver, gt)
+	return gt
+}
+
+// Register sets the storage served.  A gRPC server serves a single host, so
+// the host is ignored.
+func (gt *GRPCTransport) Register(host string, storage Storage) {
+	gt.lock.Lock()
+	gt.storage = storage
+	gt.lock.Unlock()
+}
+
+// Returns a client for the host, reusing the connection to it
+func (gt *GRPCTransport) getClient(host string) (KvClient, error) {
+	gt.connLock.Lock()
+	defer gt.connLock.Unlock()
+	if gt.shutdown {
+		return nil, fmt.Errorf("kv transport is shutdown")
+	}
+	conn, ok := gt.conns[host]
+	if !ok {
+		var err error
+		if conn, err = grpc.Dial(host, grpc.WithInsecure()); err != nil {
+			return nil, err
+		}
+		gt.conns[host] = conn
+	}
+	return NewKvClient(conn), nil
+}
+
+// Get reads a key from a host
+func (gt *GRPCTransport) Get(ctx context.Context, host string, key []byte) ([]byte, bool, error) {
+	client, err := gt.getClient(host)
+	if err != nil {
+		return nil, false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, gt.timeout)
+	defer cancel()
+	resp, err := client.GetServe(ctx, &Key{Key: key})
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.Value, resp.Found, nil
+}
+
+// Put writes a key to a host
+func (gt *GRPCTransport) Put(ctx context.Context, host string, key, value []byte) error {
+	client, err := gt.getClient(host)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, gt.timeout)
+	defer cancel()
+	_, err = client.PutServe(ctx, &Pair{Key: key, Value: value})
+	return err
+}
+
+// Delete removes a key from a host
+func (gt *GRPCTransport) Delete(ctx context.Context, host string, key []byte) error {
+	client, err := gt.getClient(host)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, gt.timeout)
+	defer cancel()
+	_, err = client.DeleteServe(ctx, &Key{Key: key})
+	return err
+}
+
+// Returns the storage served
+func (gt *GRPCTransport) local() (Storage, error) {
+	gt.lock.RLock()
+	defer gt.lock.RUnlock()
+	if gt.storage == nil {
+		return nil, fmt.Errorf("no storage registered")
+	}
+	return gt.storage, nil
+}
+
+// GetServe serves a Get request
+func (gt *GRPCTransport) GetServe(ctx context.Context, in *Key) (*Value, error) {
+	storage, err := gt.local()
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := storage.Get(in.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Value: value, Found: found}, nil
+}
+
+// PutServe serves a Put request
+func (gt *GRPCTransport) PutServe(ctx context.Context, in *Pair) (*Empty, error) {
+	storage, err := gt.local()
+	if err != nil {
+		return nil, err
+	}
+	return &Empty{}, storage.Put(in.Key, in.Value)
+}
+
+// DeleteServe serves a Delete request
+func (gt *GRPCTransport) DeleteServe(ctx context.Context, in *Key) (*Empty, error) {
+	storage, err := gt.local()
+	if err != nil {
+		return nil, err
+	}
+	return &Empty{}, storage.Delete(in.Key)
+}
+
+// Shutdown closes the connections to the other hosts.  The grpc server is
+// left to its owner.
+func (gt *GRPCTransport) Shutdown() {
+	gt.connLock.Lock()
+	defer gt.connLock.Unlock()
+	gt.shutdown = true
+	for _, conn := range gt.conns {
+		conn.Close()
+	}
+	gt.conns = nil
+}
@@ -0,0 +1,95 @@
+package chord
+
+import (
+	"fmt"
+)
+
+// RingState is the lifecycle state of a Ring
+type RingState int
+
+const (
+	// StateJoining means the local vnodes are locating their successors
+	StateJoining RingState = iota
+	// StateActive means the local vnodes are part of the ring and stabilizing
+	StateActive
+	// StateLeaving means the local vnodes are handing their ranges over and
+	// unlinking from the ring
+	StateLeaving
+	// StateStopped means the local vnodes are shut down.  It is final.
+	StateStopped
+)
+
+func (s RingState) String() string {
+	switch s {
+	case StateJoining:
+		return "joining"
+	case StateActive:
+		return "active"
+	case StateLeaving:
+		return "leaving"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("RingState(%d)", int(s))
+}
+
+// StateError is returned when an operation is not allowed in the current
+// lifecycle state of the ring
+type StateError struct {
+	Op    string    // Operation attempted
+	State RingState // State of the ring when it was attempted
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("cannot %s a ring that is %s", e.Op, e.State)
+}
+
+// State returns the lifecycle state of the ring
+func (r *Ring) State() RingState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.state
+}
+
+// Moves the ring to a new state and informs the subscribers
+func (r *Ring) setState(state RingState) {
+	r.lock.Lock()
+	prev := r.state
+	r.state = state
+	r.lock.Unlock()
+	r.publish(Event{Type: EventStateChanged, State: state, PrevState: prev})
+}
+
+// Claims stopping the ring for an operation allowed from the given states.
+// Only one caller gets to stop the ring, the others wait for it to stop and
+// get a StateError.
+func (r *Ring) claimStop(op string, from ...RingState) error {
+	r.lock.Lock()
+	state := r.state
+	stopping := r.stopping
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == state
+	}
+	if allowed && !stopping {
+		r.stopping = true
+		r.lock.Unlock()
+		return nil
+	}
+	r.lock.Unlock()
+
+	if stopping {
+		<-r.stopped
+		state = r.State()
+	}
+	return &StateError{Op: op, State: state}
+}
+
+// Moves the stopped ring to StateStopped, stops the delegate and releases the
+// callers waiting for it
+func (r *Ring) finishStop() {
+	r.setState(StateStopped)
+	r.stopMembers()
+	r.stopDelegate()
+	close(r.stopped)
+}
@@ -0,0 +1,132 @@
+package chord
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingState(t *testing.T) {
+	ml := InitMLTransport()
+	conf := fastConf()
+	conf.Delegate = &MockDelegate{}
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if s := r.State(); s != StateActive {
+		t.Fatalf("expected active, got %s", s)
+	}
+	events, cancel := r.Subscribe(EventFilter{Types: []EventType{EventStateChanged}})
+	defer cancel()
+
+	if err := r.Leave(); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if s := r.State(); s != StateStopped {
+		t.Fatalf("expected stopped, got %s", s)
+	}
+
+	// Leaving, then stopped
+	var states []RingState
+	for ev := range events {
+		states = append(states, ev.State)
+	}
+	if len(states) != 2 || states[0] != StateLeaving || states[1] != StateStopped {
+		t.Fatalf("bad states %v", states)
+	}
+
+	// Leaving or shutting down again is refused without hanging
+	for _, f := range []func() error{r.Leave, r.Shutdown} {
+		err := f()
+		se, ok := err.(*StateError)
+		if !ok || se.State != StateStopped {
+			t.Fatalf("expected state err, got %v", err)
+		}
+	}
+}
+
+func TestJoinState(t *testing.T) {
+	ml := InitMLTransport()
+	r, err := Create(fastConf(), ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	if s := r2.State(); s != StateActive {
+		t.Fatalf("expected active, got %s", s)
+	}
+	if err := r2.Shutdown(); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if err := r2.Leave(); err == nil {
+		t.Fatalf("expected state err")
+	}
+}
+
+func TestConcurrentShutdown(t *testing.T) {
+	conf := fastConf()
+	conf.Delegate = &MockDelegate{}
+	r, err := Create(conf, nil)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	// Only one of the callers stops the ring, all of them wait for it
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		ok   int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = r.Shutdown()
+			} else {
+				err = r.Leave()
+			}
+			if r.State() != StateStopped {
+				t.Errorf("returned before the ring stopped")
+			}
+			if err == nil {
+				lock.Lock()
+				ok++
+				lock.Unlock()
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("callers hung")
+	}
+	if ok != 1 {
+		t.Fatalf("expected a single successful stop, got %d", ok)
+	}
+}
+
+func TestRingStateString(t *testing.T) {
+	if s := StateLeaving.String(); s != "leaving" {
+		t.Fatalf("bad string %s", s)
+	}
+	err := &StateError{Op: "leave", State: StateStopped}
+	if err.Error() != "cannot leave a ring that is stopped" {
+		t.Fatalf("bad error %s", err)
+	}
+}
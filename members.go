@@ -0,0 +1,166 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// Member is a vnode of the ring listed by Members
+type Member struct {
+	Vnode *Vnode
+	Meta  Meta // Decoded metadata of the vnode, nil if it has none
+}
+
+// Membership lists the vnodes of the whole ring
+type Membership struct {
+	Vnodes  []*Member            // Every vnode, sorted by ID
+	Hosts   map[string][]*Member // Vnodes of each host, sorted by ID
+	Updated time.Time            // When the ring was walked
+}
+
+// Caches the last ring walk, refreshed in the background
+type memberCache struct {
+	lock    sync.Mutex
+	members *Membership
+	stop    chan struct{} // Stops the refresh, nil until started
+	stopped bool
+}
+
+// Members returns every vnode of the ring, found by walking the successor
+// lists around it.  With Config.MembersRefresh set, the first call walks the
+// ring and starts refreshing the result in the background at that interval,
+// later calls return the last result.  Otherwise every call walks the ring.
+func (r *Ring) Members(ctx context.Context) (*Membership, error) {
+	if r.config.MembersRefresh <= 0 {
+		return r.walkMembers(ctx)
+	}
+	r.members.lock.Lock()
+	members := r.members.members
+	r.members.lock.Unlock()
+	if members != nil {
+		return members, nil
+	}
+	return r.RefreshMembers(ctx)
+}
+
+// RefreshMembers walks the ring and caches the result for Members
+func (r *Ring) RefreshMembers(ctx context.Context) (*Membership, error) {
+	members, err := r.walkMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.members.lock.Lock()
+	defer r.members.lock.Unlock()
+	r.members.members = members
+	if r.config.MembersRefresh > 0 && r.members.stop == nil && !r.members.stopped {
+		r.members.stop = make(chan struct{})
+		go r.refreshMembers(r.members.stop)
+	}
+	return members, nil
+}
+
+// Refreshes the cached members until stopped
+func (r *Ring) refreshMembers(stop chan struct{}) {
+	interval := r.config.MembersRefresh
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if _, err := r.RefreshMembers(ctx); err != nil {
+			log.Printf("[ERR] Failed to refresh the ring members: %s", err)
+		}
+		cancel()
+	}
+}
+
+// Stops the background refresh of the members
+func (r *Ring) stopMembers() {
+	r.members.lock.Lock()
+	defer r.members.lock.Unlock()
+	r.members.stopped = true
+	if r.members.stop != nil {
+		close(r.members.stop)
+		r.members.stop = nil
+	}
+}
+
+// Collects the vnodes of the ring, jumping from each vnode to the last of its
+// successors until the lists wrap back to the start
+func (r *Ring) walkMembers(ctx context.Context) (*Membership, error) {
+	vnodes := r.localVnodes()
+	if len(vnodes) == 0 {
+		return nil, fmt.Errorf("ring has no local vnodes")
+	}
+	start := &vnodes[0].Vnode
+	hb := r.config.hashBits
+	seen := map[string]*Vnode{start.StringID(): start}
+
+	cur := start
+	for done := false; !done; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// The successors of the key just past a vnode are its successor list
+		succs, err := r.transport.FindSuccessors(ctx, cur, r.config.NumSuccessors, powerOffset(cur.Id, 0, hb))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the successors of %s: %s", cur, err)
+		}
+
+		prev, next := cur, (*Vnode)(nil)
+		for _, s := range succs {
+			if s == nil {
+				continue
+			}
+			// Stop once past the start
+			if betweenRightIncl(prev.Id, s.Id, start.Id) {
+				done = true
+				break
+			}
+			if _, ok := seen[s.StringID()]; ok {
+				return nil, fmt.Errorf("ring walk looped back to %s", s)
+			}
+			seen[s.StringID()] = s
+			prev, next = s, s
+		}
+		if next == nil {
+			break
+		}
+		cur = next
+	}
+
+	m := &Membership{
+		Vnodes:  make([]*Member, 0, len(seen)),
+		Hosts:   make(map[string][]*Member),
+		Updated: time.Now(),
+	}
+	for _, vn := range seen {
+		member := &Member{Vnode: copyVnode(vn)}
+		if len(vn.Meta) > 0 {
+			meta := make(Meta)
+			if err := meta.UnmarshalBinary(vn.Meta); err == nil {
+				member.Meta = meta
+			}
+		}
+		m.Vnodes = append(m.Vnodes, member)
+	}
+	sort.Slice(m.Vnodes, func(i, j int) bool {
+		return bytes.Compare(m.Vnodes[i].Vnode.Id, m.Vnodes[j].Vnode.Id) < 0
+	})
+	for _, member := range m.Vnodes {
+		m.Hosts[member.Vnode.Host] = append(m.Hosts[member.Vnode.Host], member)
+	}
+	return m, nil
+}
@@ -0,0 +1,104 @@
+package chord
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// Tags each host with a zone named after it and refreshes the members quickly
+func memberSetup(conf *Config) {
+	conf.Meta = Meta{"zone": []byte("z" + conf.Hostname[len("test"):])}
+	conf.MembersRefresh = 20 * time.Millisecond
+}
+
+func TestMembers(t *testing.T) {
+	ml := InitMLTransport()
+	rings := makeRings(t, ml, 3, memberSetup)
+	for _, r := range rings {
+		defer r.Shutdown()
+	}
+
+	// The walk jumps over several successor lists
+	rings[1].config.MembersRefresh = 0
+	m, err := rings[1].Members(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(m.Vnodes) != 24 || len(m.Hosts) != 3 {
+		t.Fatalf("bad members %d in %d hosts", len(m.Vnodes), len(m.Hosts))
+	}
+	for i, member := range m.Vnodes {
+		if i > 0 && bytes.Compare(m.Vnodes[i-1].Vnode.Id, member.Vnode.Id) >= 0 {
+			t.Fatalf("members not sorted")
+		}
+		zone := "z" + member.Vnode.Host[len("test"):]
+		if string(member.Meta["zone"]) != zone {
+			t.Fatalf("bad meta of %s: %v", member.Vnode, member.Meta)
+		}
+	}
+	for host, members := range m.Hosts {
+		if len(members) != 8 {
+			t.Fatalf("bad members of %s: %d", host, len(members))
+		}
+	}
+
+	// Cached between the refreshes
+	rings[2].config.MembersRefresh = time.Hour
+	m, err = rings[2].Members(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if m2, _ := rings[2].Members(context.Background()); m2 != m {
+		t.Fatalf("expected the cached members")
+	}
+	if m2, _ := rings[2].RefreshMembers(context.Background()); m2 == m || len(m2.Vnodes) != 24 {
+		t.Fatalf("expected fresh members")
+	}
+}
+
+func TestMembersRefresh(t *testing.T) {
+	ml := InitMLTransport()
+	rings := makeRings(t, ml, 2, memberSetup)
+	r := rings[0]
+	defer rings[1].Shutdown()
+
+	m, err := r.Members(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(m.Vnodes) != 16 {
+		t.Fatalf("bad members %d", len(m.Vnodes))
+	}
+
+	// A new host shows up once refreshed in the background
+	conf := fastConf()
+	conf.Hostname = "test3"
+	r3, err := Join(conf, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r3.Shutdown()
+	waitStable(t, r, rings[1], r3)
+	for i := 0; ; i++ {
+		m, _ = r.Members(context.Background())
+		if len(m.Vnodes) == 24 {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("members not refreshed, got %d", len(m.Vnodes))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The refresh stops with the ring
+	r.Shutdown()
+	r.members.lock.Lock()
+	stop := r.members.stop
+	r.members.lock.Unlock()
+	if stop != nil {
+		t.Fatalf("refresh still running")
+	}
+}
@@ -16,6 +16,11 @@ It has these top-level messages:
 	StringParam
 	VnodePair
 	Response
+	TraceHop
+	Trace
+	NextHops
+	FindSuccBatchReq
+	VnodeLists
 */
 package chord
 
@@ -73,6 +78,7 @@ func (m *Vnode) GetMeta() []byte {
 
 type VnodeList struct {
 	Vnodes []*Vnode `protobuf:"bytes,1,rep,name=vnodes" json:"vnodes,omitempty"`
+	Trace  *Trace   `protobuf:"bytes,2,opt,name=trace" json:"trace,omitempty"`
 }
 
 func (m *VnodeList) Reset()                    { *m = VnodeList{} }
@@ -87,10 +93,18 @@ func (m *VnodeList) GetVnodes() []*Vnode {
 	return nil
 }
 
+func (m *VnodeList) GetTrace() *Trace {
+	if m != nil {
+		return m.Trace
+	}
+	return nil
+}
+
 type FindSuccReq struct {
 	VN    *Vnode `protobuf:"bytes,1,opt,name=VN,json=vN" json:"VN,omitempty"`
 	Count int32  `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
 	Key   []byte `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Trace *Trace `protobuf:"bytes,4,opt,name=trace" json:"trace,omitempty"`
 }
 
 func (m *FindSuccReq) Reset()                    { *m = FindSuccReq{} }
@@ -119,6 +133,13 @@ func (m *FindSuccReq) GetKey() []byte {
 	return nil
 }
 
+func (m *FindSuccReq) GetTrace() *Trace {
+	if m != nil {
+		return m.Trace
+	}
+	return nil
+}
+
 type Bool struct {
 	Ok bool `protobuf:"varint,1,opt,name=ok" json:"ok,omitempty"`
 }
@@ -184,6 +205,139 @@ func (m *Response) String() string            { return proto.CompactTextString(m
 func (*Response) ProtoMessage()               {}
 func (*Response) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
+// A single step of a traced lookup
+type TraceHop struct {
+	Vnode    *Vnode `protobuf:"bytes,1,opt,name=vnode" json:"vnode,omitempty"`
+	Latency  int64  `protobuf:"varint,2,opt,name=latency" json:"latency,omitempty"`
+	Error    string `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	Fallback bool   `protobuf:"varint,4,opt,name=fallback" json:"fallback,omitempty"`
+}
+
+func (m *TraceHop) Reset()                    { *m = TraceHop{} }
+func (m *TraceHop) String() string            { return proto.CompactTextString(m) }
+func (*TraceHop) ProtoMessage()               {}
+func (*TraceHop) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *TraceHop) GetVnode() *Vnode {
+	if m != nil {
+		return m.Vnode
+	}
+	return nil
+}
+
+func (m *TraceHop) GetLatency() int64 {
+	if m != nil {
+		return m.Latency
+	}
+	return 0
+}
+
+func (m *TraceHop) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *TraceHop) GetFallback() bool {
+	if m != nil {
+		return m.Fallback
+	}
+	return false
+}
+
+// Hops of a traced lookup
+type Trace struct {
+	Hops []*TraceHop `protobuf:"bytes,1,rep,name=hops" json:"hops,omitempty"`
+}
+
+func (m *Trace) Reset()                    { *m = Trace{} }
+func (m *Trace) String() string            { return proto.CompactTextString(m) }
+func (*Trace) ProtoMessage()               {}
+func (*Trace) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *Trace) GetHops() []*TraceHop {
+	if m != nil {
+		return m.Hops
+	}
+	return nil
+}
+
+// Next hops of an iterative lookup
+type NextHops struct {
+	Successors []*Vnode `protobuf:"bytes,1,rep,name=successors" json:"successors,omitempty"`
+	Closest    []*Vnode `protobuf:"bytes,2,rep,name=closest" json:"closest,omitempty"`
+}
+
+func (m *NextHops) Reset()                    { *m = NextHops{} }
+func (m *NextHops) String() string            { return proto.CompactTextString(m) }
+func (*NextHops) ProtoMessage()               {}
+func (*NextHops) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *NextHops) GetSuccessors() []*Vnode {
+	if m != nil {
+		return m.Successors
+	}
+	return nil
+}
+
+func (m *NextHops) GetClosest() []*Vnode {
+	if m != nil {
+		return m.Closest
+	}
+	return nil
+}
+
+// Lookup of several keys through the same vnode
+type FindSuccBatchReq struct {
+	VN    *Vnode   `protobuf:"bytes,1,opt,name=VN,json=vN" json:"VN,omitempty"`
+	Count int32    `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+	Keys  [][]byte `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"`
+}
+
+func (m *FindSuccBatchReq) Reset()                    { *m = FindSuccBatchReq{} }
+func (m *FindSuccBatchReq) String() string            { return proto.CompactTextString(m) }
+func (*FindSuccBatchReq) ProtoMessage()               {}
+func (*FindSuccBatchReq) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *FindSuccBatchReq) GetVN() *Vnode {
+	if m != nil {
+		return m.VN
+	}
+	return nil
+}
+
+func (m *FindSuccBatchReq) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *FindSuccBatchReq) GetKeys() [][]byte {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+// Successors of each key of a batched lookup
+type VnodeLists struct {
+	Lists []*VnodeList `protobuf:"bytes,1,rep,name=lists" json:"lists,omitempty"`
+}
+
+func (m *VnodeLists) Reset()                    { *m = VnodeLists{} }
+func (m *VnodeLists) String() string            { return proto.CompactTextString(m) }
+func (*VnodeLists) ProtoMessage()               {}
+func (*VnodeLists) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *VnodeLists) GetLists() []*VnodeList {
+	if m != nil {
+		return m.Lists
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Vnode)(nil), "chord.Vnode")
 	proto.RegisterType((*VnodeList)(nil), "chord.VnodeList")
@@ -192,6 +346,11 @@ func init() {
 	proto.RegisterType((*StringParam)(nil), "chord.StringParam")
 	proto.RegisterType((*VnodePair)(nil), "chord.VnodePair")
 	proto.RegisterType((*Response)(nil), "chord.Response")
+	proto.RegisterType((*TraceHop)(nil), "chord.TraceHop")
+	proto.RegisterType((*Trace)(nil), "chord.Trace")
+	proto.RegisterType((*NextHops)(nil), "chord.NextHops")
+	proto.RegisterType((*FindSuccBatchReq)(nil), "chord.FindSuccBatchReq")
+	proto.RegisterType((*VnodeLists)(nil), "chord.VnodeLists")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -212,6 +371,8 @@ type ChordClient interface {
 	FindSuccessorsServe(ctx context.Context, in *FindSuccReq, opts ...grpc.CallOption) (*VnodeList, error)
 	ClearPredecessorServe(ctx context.Context, in *VnodePair, opts ...grpc.CallOption) (*Response, error)
 	SkipSuccessorServe(ctx context.Context, in *VnodePair, opts ...grpc.CallOption) (*Response, error)
+	ClosestPrecedingServe(ctx context.Context, in *FindSuccReq, opts ...grpc.CallOption) (*NextHops, error)
+	FindSuccessorsBatchServe(ctx context.Context, in *FindSuccBatchReq, opts ...grpc.CallOption) (*VnodeLists, error)
 }
 
 type chordClient struct {
@@ -285,6 +446,24 @@ func (c *chordClient) SkipSuccessorServe(ctx context.Context, in *VnodePair, opt
 	return out, nil
 }
 
+func (c *chordClient) ClosestPrecedingServe(ctx context.Context, in *FindSuccReq, opts ...grpc.CallOption) (*NextHops, error) {
+	out := new(NextHops)
+	err := grpc.Invoke(ctx, "/chord.chord/ClosestPrecedingServe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chordClient) FindSuccessorsBatchServe(ctx context.Context, in *FindSuccBatchReq, opts ...grpc.CallOption) (*VnodeLists, error) {
+	out := new(VnodeLists)
+	err := grpc.Invoke(ctx, "/chord.chord/FindSuccessorsBatchServe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Chord service
 
 type ChordServer interface {
@@ -295,6 +474,8 @@ type ChordServer interface {
 	FindSuccessorsServe(context.Context, *FindSuccReq) (*VnodeList, error)
 	ClearPredecessorServe(context.Context, *VnodePair) (*Response, error)
 	SkipSuccessorServe(context.Context, *VnodePair) (*Response, error)
+	ClosestPrecedingServe(context.Context, *FindSuccReq) (*NextHops, error)
+	FindSuccessorsBatchServe(context.Context, *FindSuccBatchReq) (*VnodeLists, error)
 }
 
 func RegisterChordServer(s *grpc.Server, srv ChordServer) {
@@ -427,6 +608,42 @@ func _Chord_SkipSuccessorServe_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Chord_ClosestPrecedingServe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindSuccReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChordServer).ClosestPrecedingServe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chord.chord/ClosestPrecedingServe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChordServer).ClosestPrecedingServe(ctx, req.(*FindSuccReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chord_FindSuccessorsBatchServe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindSuccBatchReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChordServer).FindSuccessorsBatchServe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chord.chord/FindSuccessorsBatchServe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChordServer).FindSuccessorsBatchServe(ctx, req.(*FindSuccBatchReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Chord_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "chord.chord",
 	HandlerType: (*ChordServer)(nil),
@@ -459,6 +676,14 @@ var _Chord_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SkipSuccessorServe",
 			Handler:    _Chord_SkipSuccessorServe_Handler,
 		},
+		{
+			MethodName: "ClosestPrecedingServe",
+			Handler:    _Chord_ClosestPrecedingServe_Handler,
+		},
+		{
+			MethodName: "FindSuccessorsBatchServe",
+			Handler:    _Chord_FindSuccessorsBatchServe_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "net.proto",
@@ -467,30 +692,40 @@ var _Chord_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("net.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 395 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0x4b, 0x6b, 0xdc, 0x30,
-	0x10, 0xf6, 0x63, 0x1d, 0xe2, 0x71, 0x68, 0xc2, 0xa4, 0x2d, 0x26, 0xf4, 0x60, 0xd4, 0x1e, 0x7c,
-	0x5a, 0x68, 0xf6, 0x14, 0x68, 0x29, 0xb4, 0xd0, 0x5e, 0xca, 0x62, 0x64, 0xc8, 0xdd, 0xb5, 0x27,
-	0x1b, 0x61, 0xc7, 0xda, 0x4a, 0x5a, 0x43, 0xfe, 0x44, 0x7f, 0x73, 0x91, 0xec, 0x94, 0x7d, 0xf8,
-	0xd0, 0xdb, 0x8c, 0xe7, 0x7b, 0xcd, 0x08, 0x43, 0xdc, 0x93, 0x59, 0x6e, 0x95, 0x34, 0x12, 0xa3,
-	0xfa, 0x51, 0xaa, 0x86, 0x7d, 0x81, 0xe8, 0xbe, 0x97, 0x0d, 0xe1, 0x2b, 0x08, 0x44, 0x93, 0xfa,
-	0x99, 0x9f, 0x5f, 0xf0, 0x40, 0x34, 0x88, 0xb0, 0x78, 0x94, 0xda, 0xa4, 0x41, 0xe6, 0xe7, 0x31,
-	0x77, 0xb5, 0xfd, 0xf6, 0x44, 0xa6, 0x4a, 0x43, 0x87, 0x72, 0x35, 0xfb, 0x08, 0xb1, 0x13, 0xf8,
-	0x29, 0xb4, 0xc1, 0x0f, 0x70, 0x36, 0xd8, 0x46, 0xa7, 0x7e, 0x16, 0xe6, 0xc9, 0xed, 0xc5, 0xd2,
-	0xb9, 0x2c, 0x1d, 0x82, 0x4f, 0x33, 0x56, 0x42, 0xf2, 0x5d, 0xf4, 0x4d, 0xb9, 0xab, 0x6b, 0x4e,
-	0xbf, 0xf1, 0x1d, 0x04, 0xf7, 0x6b, 0xe7, 0x7c, 0x4c, 0x08, 0x86, 0x35, 0xbe, 0x86, 0xa8, 0x96,
-	0xbb, 0x7e, 0x0c, 0x12, 0xf1, 0xb1, 0xc1, 0x2b, 0x08, 0x5b, 0x7a, 0x9e, 0x82, 0xd8, 0x92, 0xbd,
-	0x85, 0xc5, 0x57, 0x29, 0x3b, 0xbb, 0x87, 0x6c, 0x9d, 0xda, 0x39, 0x0f, 0x64, 0xcb, 0xde, 0x43,
-	0x52, 0x1a, 0x25, 0xfa, 0x4d, 0x51, 0xa9, 0xea, 0xc9, 0xca, 0x0d, 0x55, 0xb7, 0x23, 0x87, 0x88,
-	0xf9, 0xd8, 0xb0, 0x72, 0x5a, 0xa2, 0xa8, 0x84, 0xb2, 0x4b, 0x98, 0x4a, 0x6d, 0xc8, 0xcc, 0x66,
-	0x9a, 0x66, 0x98, 0xc1, 0x42, 0x53, 0xf7, 0xe0, 0x62, 0x1d, 0x63, 0xdc, 0x84, 0x01, 0x9c, 0x73,
-	0xd2, 0x5b, 0xd9, 0x6b, 0xba, 0xfd, 0x13, 0xc2, 0x78, 0x70, 0xbc, 0x83, 0x4b, 0x7b, 0x2a, 0x07,
-	0xd4, 0x25, 0xa9, 0x81, 0x10, 0x27, 0xf2, 0x5e, 0xce, 0x9b, 0xab, 0x7d, 0x41, 0x4b, 0x60, 0x1e,
-	0xe6, 0x10, 0x17, 0xa2, 0xdf, 0x8c, 0xa4, 0x03, 0xc7, 0x9b, 0x64, 0xea, 0xec, 0x09, 0x98, 0x87,
-	0x2b, 0x48, 0xd6, 0xd2, 0x88, 0x87, 0xe7, 0x11, 0x7b, 0x20, 0x66, 0x77, 0x9c, 0x95, 0x5f, 0xc1,
-	0xf5, 0x0f, 0x32, 0x85, 0xa2, 0x86, 0x6a, 0xd2, 0x5a, 0xaa, 0x39, 0xa3, 0x83, 0x8e, 0x79, 0xf8,
-	0x19, 0xae, 0x5f, 0xde, 0xd2, 0x71, 0x8e, 0x56, 0xda, 0x7b, 0xe7, 0x59, 0xcf, 0x4f, 0xf0, 0xe6,
-	0x5b, 0x47, 0x95, 0x3a, 0x71, 0x3d, 0x8d, 0x7c, 0x39, 0x7d, 0x79, 0xb9, 0x29, 0xf3, 0xf0, 0x0e,
-	0xb0, 0x6c, 0xc5, 0xf6, 0x9f, 0xf9, 0xff, 0x53, 0x7f, 0x9d, 0xb9, 0xbf, 0x60, 0xf5, 0x37, 0x00,
-	0x00, 0xff, 0xff, 0xd4, 0x90, 0x65, 0x8b, 0x12, 0x03, 0x00, 0x00,
+	// 556 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x94, 0x41, 0x6f, 0xda, 0x4c,
+	0x10, 0x86, 0x0d, 0xb6, 0x13, 0x7b, 0xcc, 0xa7, 0xe4, 0xdb, 0xa8, 0xaa, 0x45, 0x13, 0x15, 0xed,
+	0xa1, 0xe2, 0x52, 0x2a, 0x85, 0x53, 0xa4, 0xb6, 0x87, 0x54, 0x4d, 0xa9, 0x5a, 0x21, 0x14, 0xaa,
+	0x48, 0xbd, 0x75, 0xb3, 0x1e, 0xc0, 0xc2, 0xf1, 0xba, 0xbb, 0x0b, 0x2a, 0xff, 0xa4, 0x3f, 0xb7,
+	0xda, 0x35, 0x26, 0x38, 0xf8, 0x92, 0x1b, 0xbb, 0xb3, 0xf3, 0xcc, 0x3b, 0x33, 0x2f, 0x86, 0x30,
+	0x47, 0x3d, 0x28, 0xa4, 0xd0, 0x82, 0xf8, 0x7c, 0x21, 0x64, 0x42, 0xdf, 0x81, 0x7f, 0x97, 0x8b,
+	0x04, 0x09, 0x40, 0x3b, 0x4d, 0xe2, 0x56, 0xaf, 0xd5, 0xef, 0x90, 0x0e, 0x78, 0x0b, 0xa1, 0x74,
+	0xdc, 0xee, 0xb5, 0xfa, 0xa1, 0x39, 0x3d, 0xa0, 0x66, 0xb1, 0x6b, 0x62, 0xf4, 0x06, 0x42, 0x9b,
+	0xf0, 0x3d, 0x55, 0x9a, 0x9c, 0xc3, 0xd1, 0xda, 0x1c, 0x54, 0xdc, 0xea, 0xb9, 0xfd, 0xe8, 0xb2,
+	0x33, 0xb0, 0xd4, 0x41, 0x89, 0x7c, 0x05, 0xbe, 0x96, 0x8c, 0xa3, 0xe5, 0x3c, 0x06, 0x7f, 0x98,
+	0x3b, 0xfa, 0x0b, 0xa2, 0x9b, 0x34, 0x4f, 0xa6, 0x2b, 0xce, 0x6f, 0xf1, 0x37, 0x89, 0xa1, 0x7d,
+	0x37, 0x8e, 0x5b, 0xb5, 0x87, 0x25, 0xe5, 0x3f, 0xf0, 0xb9, 0x58, 0xe5, 0xa5, 0x1a, 0x9f, 0x44,
+	0xe0, 0x2e, 0x71, 0x53, 0x8a, 0x79, 0xac, 0xe0, 0x35, 0x54, 0x20, 0xe0, 0x5d, 0x0b, 0x91, 0x99,
+	0xce, 0xc4, 0xd2, 0xa2, 0x03, 0x7a, 0x0e, 0xd1, 0x54, 0xcb, 0x34, 0x9f, 0x4f, 0x98, 0x64, 0x0f,
+	0x86, 0xbd, 0x66, 0xd9, 0x0a, 0x6d, 0x34, 0xa4, 0x9f, 0xb7, 0xbd, 0x4d, 0x58, 0x2a, 0x4d, 0x6f,
+	0x9a, 0xc9, 0x39, 0xea, 0x46, 0x55, 0x5d, 0xf0, 0x14, 0x66, 0xb3, 0xb8, 0x7d, 0x18, 0xa3, 0x00,
+	0xc1, 0x2d, 0xaa, 0x42, 0xe4, 0x0a, 0xe9, 0x4f, 0x08, 0xac, 0x9a, 0x91, 0x28, 0x8c, 0x5a, 0x3b,
+	0xad, 0x46, 0xe0, 0x09, 0x1c, 0x67, 0x4c, 0x63, 0xce, 0x37, 0x96, 0xe9, 0x1a, 0x6d, 0x28, 0xa5,
+	0x90, 0xb6, 0xd5, 0x90, 0x9c, 0x42, 0x30, 0x63, 0x59, 0x76, 0xcf, 0xf8, 0xd2, 0x76, 0x1b, 0xd0,
+	0x37, 0xe0, 0x5b, 0x34, 0xb9, 0x30, 0xeb, 0x2a, 0xaa, 0x1d, 0x9c, 0xec, 0x0f, 0x61, 0x24, 0x0a,
+	0xfa, 0x0d, 0x82, 0x31, 0xfe, 0xd1, 0x23, 0x51, 0x28, 0xd2, 0x03, 0x50, 0x2b, 0xce, 0x51, 0x29,
+	0x21, 0x9b, 0x97, 0x76, 0x01, 0xc7, 0x3c, 0x13, 0x0a, 0xed, 0xfa, 0x0f, 0xc2, 0xf4, 0x2b, 0x9c,
+	0x56, 0x6b, 0xbb, 0x66, 0x9a, 0x2f, 0x9e, 0xb5, 0xbb, 0x0e, 0x78, 0x4b, 0xdc, 0xa8, 0xd8, 0xed,
+	0xb9, 0xfd, 0x0e, 0x7d, 0x0b, 0xb0, 0x73, 0x92, 0x22, 0xaf, 0xc1, 0xcf, 0xcc, 0x8f, 0xad, 0xa8,
+	0xd3, 0x7d, 0x8e, 0x79, 0x71, 0xf9, 0xd7, 0x83, 0xd2, 0xb3, 0xe4, 0x0a, 0x4e, 0xcc, 0x8d, 0x0d,
+	0xa9, 0x29, 0xca, 0x35, 0x12, 0xb2, 0x7d, 0xbe, 0xb7, 0xdc, 0xee, 0x01, 0x82, 0x3a, 0xa4, 0x0f,
+	0xe1, 0x24, 0xcd, 0xe7, 0x65, 0x52, 0x4d, 0x6b, 0x37, 0xda, 0x9e, 0x8c, 0x67, 0xa8, 0x43, 0x86,
+	0x10, 0x8d, 0x85, 0x4e, 0x67, 0x9b, 0xf2, 0x6d, 0x0d, 0x66, 0xfc, 0xd1, 0x88, 0x1f, 0xc2, 0xd9,
+	0x17, 0xd4, 0x13, 0x89, 0x09, 0x96, 0x33, 0x6e, 0x2a, 0x54, 0x1f, 0xa8, 0x43, 0x3e, 0xc0, 0x59,
+	0x35, 0xd2, 0x72, 0x2f, 0xf5, 0x96, 0xf6, 0xfe, 0x25, 0x8d, 0x35, 0xdf, 0xc3, 0x8b, 0x4f, 0x19,
+	0x32, 0x79, 0x50, 0xf5, 0x50, 0x72, 0x65, 0x8d, 0x9d, 0x3b, 0x1d, 0x72, 0x05, 0x64, 0xba, 0x4c,
+	0x8b, 0x5d, 0xf1, 0x67, 0xa4, 0x7e, 0x34, 0x85, 0xad, 0x53, 0x26, 0x12, 0x39, 0x26, 0xbb, 0xb9,
+	0x36, 0x29, 0xaf, 0xf2, 0x2b, 0x27, 0x52, 0x87, 0x8c, 0x20, 0xae, 0xf7, 0x6d, 0x0d, 0x55, 0x22,
+	0x5e, 0x3e, 0x41, 0x54, 0x5e, 0xeb, 0xfe, 0xff, 0x74, 0x02, 0x8a, 0x3a, 0xf7, 0x47, 0xf6, 0x93,
+	0x36, 0xfc, 0x37, 0x00, 0x94, 0xa1, 0x3b, 0x92, 0xdf, 0x04, 0x00, 0x00,
 }
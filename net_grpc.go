@@ -89,8 +89,16 @@ func (cs *GRPCTransport) Register(v *Vnode, o VnodeRPC) {
 	cs.lock.Unlock()
 }
 
+// Deregister stops serving the vnode rpc's for a vnode.
+func (cs *GRPCTransport) Deregister(v *Vnode) {
+	key := v.StringID()
+	cs.lock.Lock()
+	delete(cs.local, key)
+	cs.lock.Unlock()
+}
+
 // ListVnodes gets a list of the vnodes on the box
-func (cs *GRPCTransport) ListVnodes(host string) ([]*Vnode, error) {
+func (cs *GRPCTransport) ListVnodes(ctx context.Context, host string) ([]*Vnode, error) {
 	// Get a conn
 	out, err := cs.getConn(host)
 	if err != nil {
@@ -102,7 +110,7 @@ func (cs *GRPCTransport) ListVnodes(host string) ([]*Vnode, error) {
 	errChan := make(chan error, 1)
 
 	go func() {
-		le, err := out.client.ListVnodesServe(context.Background(), &StringParam{Value: host})
+		le, err := out.client.ListVnodesServe(ctx, &StringParam{Value: host})
 		// Return the connection
 		cs.returnConn(out)
 
@@ -115,6 +123,8 @@ func (cs *GRPCTransport) ListVnodes(host string) ([]*Vnode, error) {
 	}()
 
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(cs.timeout):
 		return nil, errTimedOut
 	case err := <-errChan:
@@ -125,7 +135,7 @@ func (cs *GRPCTransport) ListVnodes(host string) ([]*Vnode, error) {
 }
 
 // Ping a Vnode, check for liveness
-func (cs *GRPCTransport) Ping(target *Vnode) (bool, error) {
+func (cs *GRPCTransport) Ping(ctx context.Context, target *Vnode) (bool, error) {
 	out, err := cs.getConn(target.Host)
 	if err != nil {
 		return false, err
@@ -137,7 +147,7 @@ func (cs *GRPCTransport) Ping(target *Vnode) (bool, error) {
 
 	go func() {
 
-		be, err := out.client.PingServe(context.Background(), target)
+		be, err := out.client.PingServe(ctx, target)
 		// Return the connection
 		cs.returnConn(out)
 
@@ -150,6 +160,8 @@ func (cs *GRPCTransport) Ping(target *Vnode) (bool, error) {
 	}()
 
 	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
 	case <-time.After(cs.timeout):
 		return false, errTimedOut
 	case err := <-errChan:
@@ -160,7 +172,7 @@ func (cs *GRPCTransport) Ping(target *Vnode) (bool, error) {
 }
 
 // GetPredecessor requests a vnode's predecessor
-func (cs *GRPCTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
+func (cs *GRPCTransport) GetPredecessor(ctx context.Context, vn *Vnode) (*Vnode, error) {
 	// Get a conn
 	out, err := cs.getConn(vn.Host)
 	if err != nil {
@@ -172,7 +184,7 @@ func (cs *GRPCTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
 
 	go func(vnode *Vnode) {
 		//
-		vnd, err := out.client.GetPredecessorServe(context.Background(), vnode)
+		vnd, err := out.client.GetPredecessorServe(ctx, vnode)
 		// Return the connection
 		cs.returnConn(out)
 
@@ -185,6 +197,8 @@ func (cs *GRPCTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
 	}(vn)
 
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(cs.timeout):
 		return nil, errTimedOut
 	case err := <-errChan:
@@ -195,7 +209,7 @@ func (cs *GRPCTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
 }
 
 // Notify our successor of ourselves
-func (cs *GRPCTransport) Notify(target, self *Vnode) ([]*Vnode, error) {
+func (cs *GRPCTransport) Notify(ctx context.Context, target, self *Vnode) ([]*Vnode, error) {
 	// Get a conn
 	out, err := cs.getConn(target.Host)
 	if err != nil {
@@ -206,7 +220,7 @@ func (cs *GRPCTransport) Notify(target, self *Vnode) ([]*Vnode, error) {
 	errChan := make(chan error, 1)
 
 	go func() {
-		le, err := out.client.NotifyServe(context.Background(), &VnodePair{Target: target, Self: self})
+		le, err := out.client.NotifyServe(ctx, &VnodePair{Target: target, Self: self})
 		cs.returnConn(out)
 
 		if err == nil {
@@ -218,6 +232,8 @@ func (cs *GRPCTransport) Notify(target, self *Vnode) ([]*Vnode, error) {
 	}()
 
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(cs.timeout):
 		return nil, errTimedOut
 	case err := <-errChan:
@@ -228,24 +244,30 @@ func (cs *GRPCTransport) Notify(target, self *Vnode) ([]*Vnode, error) {
 }
 
 // FindSuccessors given the vnode upto n successors
-func (cs *GRPCTransport) FindSuccessors(vn *Vnode, n int, k []byte) ([]*Vnode, error) {
+func (cs *GRPCTransport) FindSuccessors(ctx context.Context, vn *Vnode, n int, k []byte) ([]*Vnode, error) {
 	// Get a conn
 	out, err := cs.getConn(vn.Host)
 	if err != nil {
 		return nil, err
 	}
 
-	respChan := make(chan []*Vnode, 1)
+	respChan := make(chan *VnodeList, 1)
 	errChan := make(chan error, 1)
 
+	// Ask the remote host to trace its hops as well
+	trace := traceFrom(ctx)
+
 	go func() {
 		req := &FindSuccReq{VN: vn, Count: int32(n), Key: k}
-		le, err := out.client.FindSuccessorsServe(context.Background(), req)
+		if trace != nil {
+			req.Trace = &Trace{}
+		}
+		le, err := out.client.FindSuccessorsServe(ctx, req)
 		// Return the connection
 		cs.returnConn(out)
 
 		if err == nil {
-			respChan <- le.Vnodes
+			respChan <- le
 		} else {
 			errChan <- err
 		}
@@ -253,17 +275,103 @@ func (cs *GRPCTransport) FindSuccessors(vn *Vnode, n int, k []byte) ([]*Vnode, e
 	}()
 
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(cs.timeout):
 		return nil, errTimedOut
 	case err := <-errChan:
 		return nil, err
 	case res := <-respChan:
-		return res, nil
+		trace.extend(res.Trace.GetHops())
+		return res.Vnodes, nil
+	}
+}
+
+// ClosestPreceding gets the successors of a vnode and the vnodes it knows
+// closest preceding the key.  Used for iterative lookups.
+func (cs *GRPCTransport) ClosestPreceding(ctx context.Context, vn *Vnode, n int, k []byte) ([]*Vnode, []*Vnode, error) {
+	// Get a conn
+	out, err := cs.getConn(vn.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	respChan := make(chan *NextHops, 1)
+	errChan := make(chan error, 1)
+
+	go func() {
+		req := &FindSuccReq{VN: vn, Count: int32(n), Key: k}
+		hops, err := out.client.ClosestPrecedingServe(ctx, req)
+		// Return the connection
+		cs.returnConn(out)
+
+		if err == nil {
+			respChan <- hops
+		} else {
+			errChan <- err
+		}
+
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-time.After(cs.timeout):
+		return nil, nil, errTimedOut
+	case err := <-errChan:
+		return nil, nil, err
+	case res := <-respChan:
+		return res.Successors, res.Closest, nil
+	}
+}
+
+// FindSuccessorsBatch finds the successors of several keys with one call to
+// the vnode.
+func (cs *GRPCTransport) FindSuccessorsBatch(ctx context.Context, vn *Vnode, n int, keys [][]byte) ([][]*Vnode, error) {
+	// Get a conn
+	out, err := cs.getConn(vn.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	respChan := make(chan *VnodeLists, 1)
+	errChan := make(chan error, 1)
+
+	go func() {
+		req := &FindSuccBatchReq{VN: vn, Count: int32(n), Keys: keys}
+		lists, err := out.client.FindSuccessorsBatchServe(ctx, req)
+		// Return the connection
+		cs.returnConn(out)
+
+		if err == nil {
+			respChan <- lists
+		} else {
+			errChan <- err
+		}
+
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(cs.timeout):
+		return nil, errTimedOut
+	case err := <-errChan:
+		return nil, err
+	case res := <-respChan:
+		if len(res.Lists) != len(keys) {
+			return nil, fmt.Errorf("expected %d successor lists, got %d", len(keys), len(res.Lists))
+		}
+		succs := make([][]*Vnode, len(res.Lists))
+		for i, list := range res.Lists {
+			succs[i] = list.GetVnodes()
+		}
+		return succs, nil
 	}
 }
 
 // ClearPredecessor clears a predecessor if it matches a given vnode. Used to leave.
-func (cs *GRPCTransport) ClearPredecessor(target, self *Vnode) error {
+func (cs *GRPCTransport) ClearPredecessor(ctx context.Context, target, self *Vnode) error {
 	// Get a conn
 	out, err := cs.getConn(target.Host)
 	if err != nil {
@@ -274,7 +382,7 @@ func (cs *GRPCTransport) ClearPredecessor(target, self *Vnode) error {
 	errChan := make(chan error, 1)
 
 	go func() {
-		_, err := out.client.ClearPredecessorServe(context.Background(), &VnodePair{Target: target, Self: self})
+		_, err := out.client.ClearPredecessorServe(ctx, &VnodePair{Target: target, Self: self})
 		// Return the connection
 		cs.returnConn(out)
 		if err == nil {
@@ -286,6 +394,8 @@ func (cs *GRPCTransport) ClearPredecessor(target, self *Vnode) error {
 	}()
 
 	select {
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-time.After(cs.timeout):
 		return errTimedOut
 	case err := <-errChan:
@@ -296,7 +406,7 @@ func (cs *GRPCTransport) ClearPredecessor(target, self *Vnode) error {
 }
 
 // SkipSuccessor instructs a node to skip a given successor. Used to leave.
-func (cs *GRPCTransport) SkipSuccessor(target, self *Vnode) error {
+func (cs *GRPCTransport) SkipSuccessor(ctx context.Context, target, self *Vnode) error {
 
 	// Get a conn
 	out, err := cs.getConn(target.Host)
@@ -308,7 +418,7 @@ func (cs *GRPCTransport) SkipSuccessor(target, self *Vnode) error {
 	errChan := make(chan error, 1)
 
 	go func() {
-		_, err := out.client.SkipSuccessorServe(context.Background(), &VnodePair{Target: target, Self: self})
+		_, err := out.client.SkipSuccessorServe(ctx, &VnodePair{Target: target, Self: self})
 		// Return the connection
 		cs.returnConn(out)
 
@@ -321,6 +431,8 @@ func (cs *GRPCTransport) SkipSuccessor(target, self *Vnode) error {
 	}()
 
 	select {
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-time.After(cs.timeout):
 		return errTimedOut
 	case err := <-errChan:
@@ -424,7 +536,7 @@ func (cs *GRPCTransport) NotifyServe(ctx context.Context, in *VnodePair) (*Vnode
 
 	if ok {
 		var nodes []*Vnode
-		if nodes, err = obj.Notify(in.Self); err == nil {
+		if nodes, err = obj.Notify(ctx, in.Self); err == nil {
 			resp.Vnodes = trimSlice(nodes)
 		}
 	} else {
@@ -443,7 +555,7 @@ func (cs *GRPCTransport) GetPredecessorServe(ctx context.Context, in *Vnode) (*V
 		err error
 	)
 	if ok {
-		vn, err = obj.GetPredecessor()
+		vn, err = obj.GetPredecessor(ctx)
 		if err == nil {
 
 			//
@@ -470,10 +582,60 @@ func (cs *GRPCTransport) FindSuccessorsServe(ctx context.Context, in *FindSuccRe
 	)
 
 	if ok {
+		// Record the hops made from here if the caller traces the lookup
+		var trace *lookupTrace
+		if in.Trace != nil {
+			trace = &lookupTrace{}
+			ctx = withTrace(ctx, trace)
+		}
+
 		var nodes []*Vnode
-		if nodes, err = obj.FindSuccessors(int(in.Count), in.Key); err == nil {
+		if nodes, err = obj.FindSuccessors(ctx, int(in.Count), in.Key); err == nil {
 			resp.Vnodes = trimSlice(nodes)
 		}
+		if trace != nil {
+			resp.Trace = &Trace{Hops: trace.list()}
+		}
+	} else {
+		err = fmt.Errorf("target vnode not found: %s/%x", in.VN.Host, in.VN.Id)
+	}
+
+	return resp, err
+}
+
+// ClosestPrecedingServe serves a ClosestPreceding request
+func (cs *GRPCTransport) ClosestPrecedingServe(ctx context.Context, in *FindSuccReq) (*NextHops, error) {
+	var (
+		obj, ok = cs.get(in.VN)
+		resp    = &NextHops{}
+		err     error
+	)
+
+	if ok {
+		resp.Successors, resp.Closest, err = obj.ClosestPreceding(ctx, int(in.Count), in.Key)
+	} else {
+		err = fmt.Errorf("target vnode not found: %s/%x", in.VN.Host, in.VN.Id)
+	}
+
+	return resp, err
+}
+
+// FindSuccessorsBatchServe serves a FindSuccessorsBatch request
+func (cs *GRPCTransport) FindSuccessorsBatchServe(ctx context.Context, in *FindSuccBatchReq) (*VnodeLists, error) {
+	var (
+		obj, ok = cs.get(in.VN)
+		resp    = &VnodeLists{}
+		err     error
+	)
+
+	if ok {
+		var lists [][]*Vnode
+		if lists, err = obj.FindSuccessorsBatch(ctx, int(in.Count), in.Keys); err == nil {
+			resp.Lists = make([]*VnodeList, len(lists))
+			for i, nodes := range lists {
+				resp.Lists[i] = &VnodeList{Vnodes: dropNil(nodes)}
+			}
+		}
 	} else {
 		err = fmt.Errorf("target vnode not found: %s/%x", in.VN.Host, in.VN.Id)
 	}
@@ -490,7 +652,7 @@ func (cs *GRPCTransport) ClearPredecessorServe(ctx context.Context, in *VnodePai
 	)
 
 	if ok {
-		err = obj.ClearPredecessor(in.Self)
+		err = obj.ClearPredecessor(ctx, in.Self)
 	} else {
 		err = fmt.Errorf("target vnode not found: %s/%x", in.Target.Host, in.Target.Id)
 	}
@@ -507,7 +669,7 @@ func (cs *GRPCTransport) SkipSuccessorServe(ctx context.Context, in *VnodePair)
 	)
 
 	if ok {
-		err = obj.SkipSuccessor(in.Self)
+		err = obj.SkipSuccessor(ctx, in.Self)
 	} else {
 		err = fmt.Errorf("target vnode not found: %s/%x", in.Target.Host, in.Target.Id)
 	}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	context "golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
@@ -47,12 +48,12 @@ func TestGRPCJoin(t *testing.T) {
 		t.Fatalf("unexpected err. %s", err)
 	}
 
-	<-time.After(1 * time.Second)
 	// Join ring
 	r2, err := Join(c2, t2, c1.Hostname)
 	if err != nil {
 		t.Fatalf("failed to join local node! Got %s", err)
 	}
+	waitStable(t, r1, r2)
 
 	// Shutdown
 	r1.Shutdown()
@@ -85,20 +86,187 @@ func TestGRPCLeave(t *testing.T) {
 	}
 
 	// Wait for some stabilization
-	<-time.After(100 * time.Millisecond)
+	waitStable(t, r1, r2)
 
 	// Node 1 should leave
 	r1.Leave()
 	t1.Shutdown()
 
 	// Wait for stabilization
-	<-time.After(100 * time.Millisecond)
+	waitStable(t, r2)
 
 	// Verify r2 ring is still in tact
 	for _, vn := range r2.vnodes {
-		if vn.successors[0].Host != r2.config.Hostname {
-			t.Fatalf("bad successor! Got:%s:%s want: %s", vn.successors[0].Host,
-				vn.successors[0].StringID(), r2.config.Hostname)
+		if succ := vn.successor(); succ.Host != r2.config.Hostname {
+			t.Fatalf("bad successor! Got:%s:%s want: %s", succ.Host,
+				succ.StringID(), r2.config.Hostname)
 		}
 	}
 }
+
+func TestGRPCDeregister(t *testing.T) {
+	c1, t1, err := prepRingGrpc(20029)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t1.Shutdown()
+	_, t2, err := prepRingGrpc(20030)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t2.Shutdown()
+
+	// Create initial ring
+	r1, err := Create(c1, t1)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r1.Shutdown()
+
+	// Remove the last vnode and check it is no longer served
+	var vn *localVnode
+	for _, v := range r1.vnodes {
+		if v.index == c1.NumVnodes-1 {
+			vn = v
+		}
+	}
+	if err := r1.RemoveVnodes(1); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if _, err := t2.GetPredecessor(context.Background(), &vn.Vnode); err == nil {
+		t.Fatalf("expected err!")
+	}
+	vnodes, err := t2.ListVnodes(context.Background(), c1.Hostname)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(vnodes) != c1.NumVnodes-1 {
+		t.Fatalf("bad number of vnodes: %d", len(vnodes))
+	}
+}
+
+func TestGRPCFindSuccessorsTrace(t *testing.T) {
+	c1, t1, err := prepRingGrpc(20031)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t1.Shutdown()
+	_, t2, err := prepRingGrpc(20032)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t2.Shutdown()
+
+	// Create initial ring
+	r1, err := Create(c1, t1)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r1.Shutdown()
+
+	// Ask the first vnode for a key owned half way around the ring, the
+	// remote host has to forward the lookup
+	vnodes := r1.localVnodes()
+	key := vnodes[len(vnodes)/2].Id
+	trace := &lookupTrace{}
+	ctx := withTrace(context.Background(), trace)
+	succs, err := t2.FindSuccessors(ctx, &vnodes[0].Vnode, 1, key)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(succs) != 1 || succs[0].StringID() != vnodes[len(vnodes)/2].StringID() {
+		t.Fatalf("bad successor")
+	}
+
+	hops := trace.list()
+	if len(hops) == 0 {
+		t.Fatalf("remote hops missing")
+	}
+	for _, hop := range hops {
+		if hop.Vnode.Host != c1.Hostname || hop.Error != "" {
+			t.Fatalf("bad hop %v", hop)
+		}
+	}
+}
+
+func TestGRPCLookupIterative(t *testing.T) {
+	c1, t1, err := prepRingGrpc(20033)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t1.Shutdown()
+	c2, t2, err := prepRingGrpc(20034)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t2.Shutdown()
+	c1.LookupMode = LookupIterative
+	c2.LookupMode = LookupIterative
+
+	// Create initial ring
+	r1, err := Create(c1, t1)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r1.Shutdown()
+
+	// Join ring
+	r2, err := Join(c2, t2, c1.Hostname)
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r1, r2)
+
+	// Both rings agree on the lookups
+	keys := [][]byte{[]byte("test"), []byte("foo"), []byte("bar")}
+	for _, k := range keys {
+		_, _, vn1, err := r1.Lookup(3, k)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		_, _, vn2, err := r2.Lookup(3, k)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		if len(vn1) != len(vn2) {
+			t.Fatalf("result len differs!")
+		}
+		for idx := range vn1 {
+			if vn1[idx].StringID() != vn2[idx].StringID() {
+				t.Fatalf("results differ!")
+			}
+		}
+	}
+}
+
+func TestGRPCLookupBatch(t *testing.T) {
+	c1, t1, err := prepRingGrpc(20035)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t1.Shutdown()
+	c2, t2, err := prepRingGrpc(20036)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer t2.Shutdown()
+
+	// Create initial ring
+	r1, err := Create(c1, t1)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r1.Shutdown()
+
+	// Join ring
+	r2, err := Join(c2, t2, c1.Hostname)
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r1, r2)
+
+	checkLookupBatch(t, r1)
+	checkLookupBatch(t, r2)
+}
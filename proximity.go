@@ -0,0 +1,159 @@
+package chord
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Smoothed round trip times of the remote hosts
+type latencyTracker struct {
+	lock      sync.RWMutex
+	hosts     map[string]*hostLatency
+	lastPrune time.Time
+}
+
+type hostLatency struct {
+	srtt    time.Duration // Smoothed round trip time
+	updated time.Time     // Last measurement
+}
+
+// Records a round trip time, smoothed the same way as TCP does.  Hosts not
+// measured for the given age are forgotten.
+func (l *latencyTracker) record(host string, rtt time.Duration, now time.Time, maxAge time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.hosts == nil {
+		l.hosts = make(map[string]*hostLatency)
+	}
+	if maxAge > 0 && now.Sub(l.lastPrune) >= maxAge {
+		l.lastPrune = now
+		for h, hl := range l.hosts {
+			if now.Sub(hl.updated) > maxAge {
+				delete(l.hosts, h)
+			}
+		}
+	}
+
+	hl, ok := l.hosts[host]
+	if !ok {
+		l.hosts[host] = &hostLatency{srtt: rtt, updated: now}
+		return
+	}
+	hl.srtt += (rtt - hl.srtt) / 8
+	hl.updated = now
+}
+
+// Returns the smoothed round trip time of a host
+func (l *latencyTracker) get(host string) (time.Duration, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if hl, ok := l.hosts[host]; ok {
+		return hl.srtt, true
+	}
+	return 0, false
+}
+
+// Records a round trip time measured by the transport
+func (r *Ring) recordRTT(host string, rtt time.Duration) {
+	if host == r.config.Hostname {
+		return
+	}
+	r.latency.record(host, rtt, time.Now(), detectorExpiry*r.config.StabilizeMax)
+}
+
+// RTT returns the smoothed round trip time of a host, measured from the
+// single hop RPCs sent to it.  The local host is always 0.
+func (r *Ring) RTT(host string) (time.Duration, bool) {
+	if host == r.config.Hostname {
+		return 0, true
+	}
+	return r.latency.get(host)
+}
+
+// RTTs returns the smoothed round trip time of every remote host measured
+func (r *Ring) RTTs() map[string]time.Duration {
+	r.latency.lock.RLock()
+	defer r.latency.lock.RUnlock()
+	out := make(map[string]time.Duration, len(r.latency.hosts))
+	for host, hl := range r.latency.hosts {
+		out[host] = hl.srtt
+	}
+	return out
+}
+
+// Returns the candidate with the lowest round trip time.  The first one is
+// kept unless another is known to be faster.
+func (r *Ring) nearest(candidates []*Vnode) *Vnode {
+	best := candidates[0]
+	bestRTT, known := r.RTT(best.Host)
+	for _, c := range candidates[1:] {
+		if rtt, ok := r.RTT(c.Host); ok && (!known || rtt < bestRTT) {
+			best, bestRTT, known = c, rtt, true
+		}
+	}
+	return best
+}
+
+// Returns the nodes, in ring order from the first one, lying before the
+// limit.  A limit equal to our own ID stands for the whole ring.
+func (vn *localVnode) candidatesBefore(nodes []*Vnode, limit []byte) []*Vnode {
+	full := bytes.Equal(limit, vn.Id)
+	out := []*Vnode{nodes[0]}
+	for _, c := range nodes[1:] {
+		if c == nil || bytes.Equal(c.Id, vn.Id) || (!full && !between(vn.Id, limit, c.Id)) {
+			break
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Orders the candidates preceding the key by the progress they make, then by
+// their round trip time.  Candidates whose distance to the key has the same
+// bit length make the same progress, halving the remaining distance.
+func (cp *closestPreceedingVnodeIterator) proximityOrder() []*Vnode {
+	vn := cp.vn
+	hb := vn.ring.config.hashBits
+
+	type candidate struct {
+		node  *Vnode
+		level int
+		rtt   time.Duration
+		known bool
+	}
+	var cands []candidate
+	seen := make(map[string]bool)
+	for _, list := range [][]*Vnode{cp.successors, cp.finger} {
+		for _, n := range list {
+			if n == nil || seen[n.StringID()] || !between(vn.Id, cp.key, n.Id) {
+				continue
+			}
+			seen[n.StringID()] = true
+			rtt, known := vn.ring.RTT(n.Host)
+			level := distance(n.Id, cp.key, hb).BitLen()
+			cands = append(cands, candidate{n, level, rtt, known})
+		}
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.level != b.level {
+			return a.level < b.level
+		}
+		if a.known != b.known {
+			return a.known
+		}
+		if a.rtt != b.rtt {
+			return a.rtt < b.rtt
+		}
+		return distance(a.node.Id, cp.key, hb).Cmp(distance(b.node.Id, cp.key, hb)) < 0
+	})
+
+	order := make([]*Vnode, len(cands))
+	for i, c := range cands {
+		order[i] = c.node
+	}
+	return order
+}
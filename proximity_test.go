@@ -0,0 +1,132 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	var l latencyTracker
+	now := time.Now()
+	l.record("a", 80*time.Millisecond, now, time.Minute)
+	l.record("a", 160*time.Millisecond, now, time.Minute)
+	if rtt, ok := l.get("a"); !ok || rtt != 90*time.Millisecond {
+		t.Fatalf("bad smoothed rtt %s", rtt)
+	}
+	if _, ok := l.get("b"); ok {
+		t.Fatalf("unexpected rtt")
+	}
+
+	// Hosts not measured for a while are forgotten
+	l.record("b", time.Millisecond, now.Add(time.Hour), time.Minute)
+	if _, ok := l.get("a"); ok {
+		t.Fatalf("expected a to be forgotten")
+	}
+}
+
+func TestRingNearestRTT(t *testing.T) {
+	r := makeRing()
+	r.config.Hostname = "local"
+	a := &Vnode{Id: []byte{1}, Host: "a"}
+	b := &Vnode{Id: []byte{2}, Host: "b"}
+	c := &Vnode{Id: []byte{3}, Host: "c"}
+	local := &Vnode{Id: []byte{4}, Host: "local"}
+
+	// Nothing known, keep the first
+	if n := r.nearest([]*Vnode{a, b, c}); n != a {
+		t.Fatalf("expected a, got %s", n)
+	}
+
+	r.recordRTT("b", 20*time.Millisecond)
+	r.recordRTT("c", 10*time.Millisecond)
+	if n := r.nearest([]*Vnode{a, b, c}); n != c {
+		t.Fatalf("expected c, got %s", n)
+	}
+	if n := r.nearest([]*Vnode{a, b, c, local}); n != local {
+		t.Fatalf("expected the local vnode, got %s", n)
+	}
+	if rtts := r.RTTs(); len(rtts) != 2 || rtts["c"] != 10*time.Millisecond {
+		t.Fatalf("bad rtts %v", rtts)
+	}
+}
+
+func TestCandidatesBefore(t *testing.T) {
+	vn := &localVnode{}
+	vn.Id = []byte{50}
+	nodes := []*Vnode{{Id: []byte{60}}, {Id: []byte{70}}, {Id: []byte{90}}, {Id: []byte{10}}}
+
+	if c := vn.candidatesBefore(nodes, []byte{80}); len(c) != 2 || c[1] != nodes[1] {
+		t.Fatalf("bad candidates %v", c)
+	}
+
+	// Up to the wrap around
+	if c := vn.candidatesBefore(nodes, []byte{20}); len(c) != 4 {
+		t.Fatalf("bad candidates %v", c)
+	}
+
+	// The whole ring stops at ourself
+	nodes = append(nodes, &vn.Vnode, &Vnode{Id: []byte{55}})
+	if c := vn.candidatesBefore(nodes, vn.Id); len(c) != 4 {
+		t.Fatalf("bad candidates %v", c)
+	}
+}
+
+func TestNextClosestProximity(t *testing.T) {
+	// Make the vnodes on the ring (mod 64)
+	v1 := &Vnode{Id: []byte{1}, Host: "far"}
+	v2 := &Vnode{Id: []byte{10}, Host: "far"}
+	v3 := &Vnode{Id: []byte{20}, Host: "near"}
+	v6 := &Vnode{Id: []byte{59}, Host: "near"}
+
+	vn := &localVnode{}
+	vn.Id = []byte{54}
+	vn.successors = []*Vnode{v6, nil}
+	vn.finger = []*Vnode{v6, v6, v6, v1, v2, v3}
+	vn.ring = &Ring{}
+	vn.ring.config = &Config{hashBits: 6, ProximityRouting: true}
+	vn.ring.recordRTT("far", 50*time.Millisecond)
+	vn.ring.recordRTT("near", time.Millisecond)
+
+	// v2 and v3 are both within 16 of the key, the nearer host goes first
+	cp := &closestPreceedingVnodeIterator{}
+	cp.init(vn, []byte{32})
+	for i, expect := range []*Vnode{v3, v2, v1, v6, nil} {
+		if n := cp.Next(); n != expect {
+			t.Fatalf("step %d: expected %v, got %v", i, expect, n)
+		}
+	}
+}
+
+func TestProximityRouting(t *testing.T) {
+	rings := makeRings(t, InitMLTransport(), 3, func(conf *Config) {
+		conf.ProximityRouting = true
+	})
+	for _, r := range rings {
+		defer r.Shutdown()
+	}
+
+	// The other hosts were measured
+	if _, ok := rings[0].RTT("test2"); !ok {
+		t.Fatalf("expected the rtt of test2")
+	}
+
+	// Lookups still find the right successors from every ring
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		_, _, expect, err := rings[0].Lookup(1, key)
+		if err != nil {
+			t.Fatalf("unexpected err. %s", err)
+		}
+		for _, r := range rings[1:] {
+			_, _, succs, err := r.Lookup(1, key)
+			if err != nil {
+				t.Fatalf("unexpected err. %s", err)
+			}
+			if !bytes.Equal(succs[0].Id, expect[0].Id) {
+				t.Fatalf("rings disagree on %s: %s and %s", key, succs[0], expect[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package chord
+
+import (
+	"bytes"
+)
+
+// KeyRange is a part of the hash space owned by a vnode, running from Start,
+// exclusive, around the ring to End, inclusive.  The full range of a vnode
+// starts at the ID of its predecessor and ends at its own ID.  A range whose
+// start equals its end covers the whole ring.
+type KeyRange struct {
+	Vnode *Vnode // Vnode owning the range
+	Start []byte // Start of the range, nil if the predecessor is not known yet
+	End   []byte // End of the range
+}
+
+// Contains checks if a hash is in the range.  Nothing is in a range with an
+// unknown start.
+func (k *KeyRange) Contains(hash []byte) bool {
+	if k.Start == nil {
+		return false
+	}
+	if bytes.Equal(k.Start, k.End) {
+		return true
+	}
+	return betweenRightIncl(k.Start, k.End, hash)
+}
+
+// Wraps checks if the range crosses the top of the hash space
+func (k *KeyRange) Wraps() bool {
+	return k.Start != nil && bytes.Compare(k.Start, k.End) >= 0
+}
+
+// Returns the range owned by the vnode according to its predecessor
+func (vn *localVnode) keyRange() *KeyRange {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
+
+	kr := &KeyRange{Vnode: copyVnode(&vn.Vnode), End: vn.Id}
+	if vn.predecessor != nil {
+		kr.Start = vn.predecessor.Id
+	}
+	return kr
+}
+
+// LocalRanges returns the range owned by each local vnode, in ID order.  The
+// ranges are only as accurate as the predecessors known to the vnodes, a range
+// has no start until its vnode has been notified of a predecessor.
+func (r *Ring) LocalRanges() []*KeyRange {
+	vnodes := r.localVnodes()
+	ranges := make([]*KeyRange, len(vnodes))
+	for i, vn := range vnodes {
+		ranges[i] = vn.keyRange()
+	}
+	return ranges
+}
+
+// OwnerRange hashes a key and returns the range of the local vnode owning it,
+// or nil if the key is owned by another host or its owner does not know its
+// predecessor yet.
+func (r *Ring) OwnerRange(key []byte) *KeyRange {
+	h := r.config.HashFunc()
+	h.Write(key)
+	return r.ownerRange(h.Sum(nil))
+}
+
+// IsLocal checks if a hash is owned by a local vnode, without going over the
+// network.  The hash size must match the hash function used when init'ing the
+// ring.
+func (r *Ring) IsLocal(hash []byte) bool {
+	return r.ownerRange(hash) != nil
+}
+
+// Returns the local range containing the hash
+func (r *Ring) ownerRange(hash []byte) *KeyRange {
+	for _, vn := range r.localVnodes() {
+		if kr := vn.keyRange(); kr.Contains(hash) {
+			return kr
+		}
+	}
+	return nil
+}
+
+// OwnershipDelegate can optionally be implemented by a Delegate to be told
+// which key ranges a local vnode gains and loses as its predecessor changes.
+// The range passed is owned by its Vnode after the change.
+type OwnershipDelegate interface {
+	// The local vnode took over the range from prev.  Prev is nil if the
+	// vnode had no range before and its successor is itself.
+	RangeGained(local *Vnode, rng *KeyRange, prev *Vnode)
+	// The local vnode handed the range over to rng.Vnode
+	RangeLost(local *Vnode, rng *KeyRange)
+}
+
+// Records the new predecessor of the vnode and returns the range gained or
+// lost compared to the previous one.  Must be called with the vnode lock held.
+func (vn *localVnode) updateOwned(pred *Vnode) (gained, lost *KeyRange, prev *Vnode) {
+	old := vn.owned
+	vn.owned = pred
+	self := &vn.Vnode
+
+	switch {
+	case old == nil:
+		// First range, taken over from our successor
+		prev = vn.successors[0]
+		if prev != nil && bytes.Equal(prev.Id, vn.Id) {
+			prev = nil
+		}
+		return &KeyRange{Vnode: self, Start: pred.Id, End: vn.Id}, nil, prev
+
+	case bytes.Equal(old.Id, pred.Id):
+		return nil, nil, nil
+
+	case bytes.Equal(old.Id, vn.Id):
+		// We owned the whole ring
+		return nil, &KeyRange{Vnode: pred, Start: vn.Id, End: pred.Id}, nil
+
+	case bytes.Equal(pred.Id, vn.Id) || between(pred.Id, vn.Id, old.Id):
+		// The old predecessor is gone, we own the range it had up to it
+		return &KeyRange{Vnode: self, Start: pred.Id, End: old.Id}, nil, old
+
+	default:
+		// A new vnode joined between the old predecessor and us
+		return nil, &KeyRange{Vnode: pred, Start: old.Id, End: pred.Id}, nil
+	}
+}
+
+// Informs the subscribers of a change of the owned range
+func (vn *localVnode) publishOwnership(gained, lost *KeyRange, prev *Vnode) {
+	if gained != nil {
+		vn.ring.publish(Event{Type: EventRangeGained, Local: &vn.Vnode, Range: gained, Prev: prev})
+	}
+	if lost != nil {
+		vn.ring.publish(Event{Type: EventRangeLost, Local: &vn.Vnode, Range: lost, Remote: lost.Vnode})
+	}
+}
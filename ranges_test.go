@@ -0,0 +1,219 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type MockOwnershipDelegate struct {
+	MockDelegate
+	lock  sync.Mutex
+	start map[string][]byte // Start of the range of each vnode
+}
+
+func (m *MockOwnershipDelegate) RangeGained(local *Vnode, rng *KeyRange, prev *Vnode) {
+	m.lock.Lock()
+	m.start[local.StringID()] = rng.Start
+	m.lock.Unlock()
+}
+func (m *MockOwnershipDelegate) RangeLost(local *Vnode, rng *KeyRange) {
+	m.lock.Lock()
+	m.start[local.StringID()] = rng.End
+	m.lock.Unlock()
+}
+
+// Checks the ranges tracked from the events match the predecessors
+func (m *MockOwnershipDelegate) check(r *Ring) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, kr := range r.LocalRanges() {
+		if start := m.start[kr.Vnode.StringID()]; !bytes.Equal(start, kr.Start) {
+			return fmt.Errorf("vnode %s tracked start %x, expected %x", kr.Vnode, start, kr.Start)
+		}
+	}
+	return nil
+}
+
+func TestKeyRangeContains(t *testing.T) {
+	kr := &KeyRange{Start: []byte{10}, End: []byte{20}}
+	if kr.Contains([]byte{10}) || !kr.Contains([]byte{15}) || !kr.Contains([]byte{20}) || kr.Contains([]byte{25}) {
+		t.Fatalf("bad range")
+	}
+	if kr.Wraps() {
+		t.Fatalf("should not wrap")
+	}
+
+	// Wrap around
+	kr = &KeyRange{Start: []byte{200}, End: []byte{20}}
+	if !kr.Contains([]byte{250}) || !kr.Contains([]byte{0}) || !kr.Contains([]byte{20}) || kr.Contains([]byte{100}) {
+		t.Fatalf("bad wrapped range")
+	}
+	if !kr.Wraps() {
+		t.Fatalf("should wrap")
+	}
+
+	// Own predecessor, the whole ring
+	kr = &KeyRange{Start: []byte{20}, End: []byte{20}}
+	if !kr.Contains([]byte{0}) || !kr.Contains([]byte{20}) || !kr.Contains([]byte{255}) {
+		t.Fatalf("bad full range")
+	}
+
+	// Unknown predecessor
+	kr = &KeyRange{End: []byte{20}}
+	if kr.Contains([]byte{20}) || kr.Wraps() {
+		t.Fatalf("bad unknown range")
+	}
+}
+
+func TestRingLocalRanges(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	num := len(r.vnodes)
+
+	// No predecessors known yet
+	for _, kr := range r.LocalRanges() {
+		if kr.Start != nil {
+			t.Fatalf("unexpected start")
+		}
+	}
+	if r.IsLocal(r.vnodes[0].Id) {
+		t.Fatalf("should not be local")
+	}
+
+	// Leave a gap before the first vnode, owned by another host
+	for i := 1; i < num; i++ {
+		r.vnodes[i].predecessor = &r.vnodes[i-1].Vnode
+	}
+	ranges := r.LocalRanges()
+	if len(ranges) != num {
+		t.Fatalf("expected %d ranges, got %d", num, len(ranges))
+	}
+	for i, kr := range ranges {
+		if kr.Vnode.String() != r.vnodes[i].String() {
+			t.Fatalf("bad range vnode %d", i)
+		}
+	}
+
+	for i := 1; i < num; i++ {
+		if !r.IsLocal(r.vnodes[i].Id) {
+			t.Fatalf("(%d) should be local", i)
+		}
+	}
+	if r.IsLocal(r.vnodes[0].Id) {
+		t.Fatalf("should not be local")
+	}
+
+	// The owner range matches the lookup of the key
+	key := []byte("test")
+	kh := hashKey(r, key)
+	kr := r.OwnerRange(key)
+	if owner := r.nearestVnode(kh); kr != nil && kr.Vnode.String() != r.nextLocalVnode(owner).String() {
+		t.Fatalf("bad owner range %v", kr)
+	}
+	if (kr != nil) != r.IsLocal(kh) {
+		t.Fatalf("owner range and IsLocal disagree")
+	}
+
+	// Close the ring, the first vnode owns the wrap around
+	top := make([]byte, len(r.vnodes[0].Id))
+	for i := range top {
+		top[i] = 0xff
+	}
+	r.vnodes[0].predecessor = &r.vnodes[num-1].Vnode
+	if !r.IsLocal(top) || !r.LocalRanges()[0].Wraps() {
+		t.Fatalf("should own the wrap around")
+	}
+	for i := 0; i < 20; i++ {
+		if !r.IsLocal(hashKey(r, []byte{byte(i)})) {
+			t.Fatalf("the whole ring should be local")
+		}
+	}
+}
+
+func TestVnodeUpdateOwned(t *testing.T) {
+	vn := makeVnode()
+	vn.Id = []byte{50}
+	vn.successors = []*Vnode{{Id: []byte{80}}}
+	self := &vn.Vnode
+
+	// First predecessor, taken over from our successor
+	gained, lost, prev := vn.updateOwned(&Vnode{Id: []byte{20}})
+	if lost != nil || prev != vn.successors[0] || !bytes.Equal(gained.Start, []byte{20}) || !bytes.Equal(gained.End, []byte{50}) {
+		t.Fatalf("bad first range %v %v", gained, lost)
+	}
+
+	// Same predecessor, no change
+	if gained, lost, _ = vn.updateOwned(&Vnode{Id: []byte{20}}); gained != nil || lost != nil {
+		t.Fatalf("unexpected change")
+	}
+
+	// New vnode joins in front of us
+	joined := &Vnode{Id: []byte{30}}
+	gained, lost, _ = vn.updateOwned(joined)
+	if gained != nil || lost.Vnode != joined || !bytes.Equal(lost.Start, []byte{20}) || !bytes.Equal(lost.End, []byte{30}) {
+		t.Fatalf("bad lost range %v %v", gained, lost)
+	}
+
+	// It fails, we take over from the one before it, wrapping around
+	gained, lost, prev = vn.updateOwned(&Vnode{Id: []byte{200}})
+	if lost != nil || prev != joined || gained.Vnode != self || !bytes.Equal(gained.Start, []byte{200}) || !bytes.Equal(gained.End, []byte{30}) {
+		t.Fatalf("bad gained range %v %v", gained, lost)
+	}
+
+	// Alone in the ring
+	gained, _, _ = vn.updateOwned(self)
+	if !bytes.Equal(gained.Start, []byte{50}) || !bytes.Equal(gained.End, []byte{200}) {
+		t.Fatalf("bad gained range %v", gained)
+	}
+
+	// Someone joins
+	gained, lost, _ = vn.updateOwned(joined)
+	if gained != nil || !bytes.Equal(lost.Start, []byte{50}) || !bytes.Equal(lost.End, []byte{30}) {
+		t.Fatalf("bad lost range %v", lost)
+	}
+}
+
+func TestRingOwnershipEvents(t *testing.T) {
+	d := &MockOwnershipDelegate{start: make(map[string][]byte)}
+	ml := InitMLTransport()
+
+	conf := fastConf()
+	conf.Delegate = d
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	// The events add up to the current ranges
+	for i := 0; ; i++ {
+		err := d.check(r)
+		if err == nil {
+			break
+		}
+		if i == 500 {
+			t.Fatalf("ranges do not match: %s", err)
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+// Returns the hash of a key
+func hashKey(r *Ring, key []byte) []byte {
+	h := r.config.HashFunc()
+	h.Write(key)
+	return h.Sum(nil)
+}
@@ -0,0 +1,197 @@
+package chord
+
+import (
+	"fmt"
+	"sort"
+
+	context "golang.org/x/net/context"
+)
+
+// RecoverySource is where an isolated vnode found its way back into the ring
+type RecoverySource int
+
+const (
+	// RecoveredLocal means another local vnode located the successors
+	RecoveredLocal RecoverySource = iota
+	// RecoveredFinger means a finger table entry located the successors
+	RecoveredFinger
+	// RecoveredSeed means one of the configured seed hosts located the
+	// successors
+	RecoveredSeed
+	// RecoveredLocalOnly means no remote vnode could be reached and the vnode
+	// now points at the next local vnode
+	RecoveredLocalOnly
+)
+
+func (rs RecoverySource) String() string {
+	switch rs {
+	case RecoveredLocal:
+		return "local"
+	case RecoveredFinger:
+		return "finger"
+	case RecoveredSeed:
+		return "seed"
+	case RecoveredLocalOnly:
+		return "local-only"
+	}
+	return fmt.Sprintf("RecoverySource(%d)", int(rs))
+}
+
+// RecoveryDelegate can optionally be implemented by a Delegate to be told when
+// a vnode loses all its successors and when it recovers.
+type RecoveryDelegate interface {
+	Isolated(local *Vnode)
+	Recovered(local *Vnode, source RecoverySource, succs []*Vnode)
+}
+
+// Rebootstraps the successor list of a vnode that lost all its successors.
+// The other local vnodes are tried first, then the fingers and finally the
+// configured seeds.  If none of them can be reached the vnode falls back to
+// the next local vnode.
+func (vn *localVnode) recover() error {
+	vn.setIsolated()
+
+	ctx := context.Background()
+	conf := vn.ring.config
+
+	// Look for the successors just past our own ID
+	key := powerOffset(vn.Id, 0, conf.hashBits)
+
+	sources := []struct {
+		src  RecoverySource
+		find func(context.Context, []byte) ([]*Vnode, error)
+	}{
+		{RecoveredLocal, vn.recoverLocal},
+		{RecoveredFinger, vn.recoverFinger},
+		{RecoveredSeed, vn.recoverSeed},
+	}
+
+	var err error
+	for _, s := range sources {
+		succs, e := s.find(ctx, key)
+		if len(succs) > 0 {
+			vn.setRecovered(s.src, succs)
+			return nil
+		}
+		err = mergeErrors(err, e)
+	}
+
+	// Fall back to a ring of our own vnodes
+	if next := vn.ring.nextLocalVnode(vn); next != nil {
+		vn.setRecovered(RecoveredLocalOnly, []*Vnode{&next.Vnode})
+		return nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no vnode to recover from")
+	}
+	return err
+}
+
+// Asks the other local vnodes for our successors
+func (vn *localVnode) recoverLocal(ctx context.Context, key []byte) ([]*Vnode, error) {
+	var err error
+	for _, other := range vn.ring.localVnodes() {
+		if other == vn {
+			continue
+		}
+		res, e := other.FindSuccessors(ctx, vn.ring.config.NumSuccessors, key)
+		if succs := vn.liveSuccessors(ctx, res); len(succs) > 0 {
+			return succs, nil
+		}
+		err = mergeErrors(err, e)
+	}
+	return nil, err
+}
+
+// Asks the vnodes in our finger table for our successors
+func (vn *localVnode) recoverFinger(ctx context.Context, key []byte) ([]*Vnode, error) {
+	vn.lock.RLock()
+	fingers := make([]*Vnode, 0, len(vn.finger))
+	seen := map[string]bool{vn.StringID(): true}
+	for _, f := range vn.finger {
+		if f != nil && !seen[f.StringID()] {
+			seen[f.StringID()] = true
+			fingers = append(fingers, f)
+		}
+	}
+	vn.lock.RUnlock()
+
+	var err error
+	for _, f := range fingers {
+		res, e := vn.ring.transport.FindSuccessors(ctx, f, vn.ring.config.NumSuccessors, key)
+		if succs := vn.liveSuccessors(ctx, res); len(succs) > 0 {
+			return succs, nil
+		}
+		err = mergeErrors(err, e)
+	}
+	return nil, err
+}
+
+// Asks the configured seed hosts for our successors
+func (vn *localVnode) recoverSeed(ctx context.Context, key []byte) ([]*Vnode, error) {
+	var err error
+	for _, seed := range shuffleSeeds(vn.ring.config.Seeds) {
+		if seed == vn.Host {
+			continue
+		}
+		vnodes, e := vn.ring.transport.ListVnodes(ctx, seed)
+		if len(vnodes) == 0 {
+			err = mergeErrors(err, e)
+			continue
+		}
+		sort.Sort(vnodeSlice(vnodes))
+
+		nearest := nearestVnodeToKey(vnodes, key)
+		res, e := vn.ring.transport.FindSuccessors(ctx, nearest, vn.ring.config.NumSuccessors, key)
+		if succs := vn.liveSuccessors(ctx, res); len(succs) > 0 {
+			return succs, nil
+		}
+		err = mergeErrors(err, e)
+	}
+	return nil, err
+}
+
+// Filters a lookup result down to the successors other than ourself, as
+// long as the first of them responds.
+func (vn *localVnode) liveSuccessors(ctx context.Context, res []*Vnode) []*Vnode {
+	succs := make([]*Vnode, 0, len(res))
+	for _, s := range res {
+		if s != nil && s.StringID() != vn.StringID() {
+			succs = append(succs, s)
+		}
+	}
+	if len(succs) == 0 {
+		return nil
+	}
+	if alive, _ := vn.ring.transport.Ping(ctx, succs[0]); !alive {
+		return nil
+	}
+	return succs
+}
+
+// Marks the vnode as isolated, informing the subscribers the first time
+func (vn *localVnode) setIsolated() {
+	vn.lock.Lock()
+	was := vn.isolated
+	vn.isolated = true
+	vn.lock.Unlock()
+
+	if !was {
+		vn.ring.publish(Event{Type: EventIsolated, Local: &vn.Vnode})
+	}
+}
+
+// Installs the recovered successors and informs the subscribers
+func (vn *localVnode) setRecovered(src RecoverySource, succs []*Vnode) {
+	if len(succs) > vn.ring.config.NumSuccessors {
+		succs = succs[:vn.ring.config.NumSuccessors]
+	}
+	vn.setSuccessors(succs)
+
+	vn.lock.Lock()
+	vn.isolated = false
+	vn.lock.Unlock()
+
+	vn.ring.publish(Event{Type: EventRecovered, Local: &vn.Vnode, Source: src, Successors: succs})
+}
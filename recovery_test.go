@@ -0,0 +1,175 @@
+package chord
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+type MockRecoveryDelegate struct {
+	MockDelegate
+	lock      sync.Mutex
+	isolated  []*Vnode
+	recovered []RecoverySource
+}
+
+func (m *MockRecoveryDelegate) Isolated(local *Vnode) {
+	m.lock.Lock()
+	m.isolated = append(m.isolated, local)
+	m.lock.Unlock()
+}
+func (m *MockRecoveryDelegate) Recovered(local *Vnode, source RecoverySource, succs []*Vnode) {
+	m.lock.Lock()
+	m.recovered = append(m.recovered, source)
+	m.lock.Unlock()
+}
+
+// Returns a vnode with its own ring sharing the transport of r
+func makeRemoteVnode(r *Ring, conf *Config, idx int) *localVnode {
+	ring := &Ring{config: conf, transport: r.transport}
+	vn := &localVnode{ring: ring}
+	ring.vnodes = []*localVnode{vn}
+	vn.init(idx)
+	return vn
+}
+
+// Returns the vnode of r following the key
+func expectedSucc(t *testing.T, r *Ring, key []byte) *Vnode {
+	succs, err := r.vnodes[0].FindSuccessors(context.Background(), 1, key)
+	if err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	return succs[0]
+}
+
+func TestVnodeRecoverLocal(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	r.setLocalSuccessors()
+
+	// Isolate vn1
+	vn1 := r.vnodes[1]
+	vn1.setSuccessors(nil)
+
+	if err := vn1.recover(); err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	if vn1.successor() != &r.vnodes[2].Vnode {
+		t.Fatalf("unexpected successor! %s", vn1.successor())
+	}
+	if vn1.isolated {
+		t.Fatalf("vnode still isolated")
+	}
+}
+
+func TestVnodeRecoverFinger(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	r.setLocalSuccessors()
+
+	// A lone vnode which only knows the ring through a finger
+	vn := makeRemoteVnode(r, r.config, 99)
+	vn.finger[3] = &r.vnodes[2].Vnode
+
+	if err := vn.recover(); err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	exp := expectedSucc(t, r, vn.Id)
+	if vn.successor().StringID() != exp.StringID() {
+		t.Fatalf("unexpected successor! %s", vn.successor())
+	}
+}
+
+func TestVnodeRecoverSeed(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// A lone vnode on another host that only knows the seed
+	d := &MockRecoveryDelegate{}
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	conf2.Seeds = []string{"dead", "test"}
+	conf2.Delegate = d
+	conf2.hashBits = conf.hashBits
+	vn := makeRemoteVnode(&Ring{transport: ml}, conf2, 0)
+	vn.ring.startDelegate()
+
+	if err := vn.recover(); err != nil {
+		t.Fatalf("unexpected err %s", err)
+	}
+	exp := expectedSucc(t, r, vn.Id)
+	if vn.successor().StringID() != exp.StringID() {
+		t.Fatalf("unexpected successor! %s", vn.successor())
+	}
+	vn.ring.stopDelegate()
+
+	if len(d.isolated) != 1 || len(d.recovered) != 1 || d.recovered[0] != RecoveredSeed {
+		t.Fatalf("bad delegate calls: %v %v", d.isolated, d.recovered)
+	}
+}
+
+func TestVnodeRecoverFails(t *testing.T) {
+	vn := makeVnode()
+	vn.ring.config.hashBits = 160
+	vn.ring.config.Seeds = []string{"dead"}
+	vn.init(0)
+	vn.ring.vnodes = []*localVnode{vn}
+
+	if err := vn.recover(); err == nil {
+		t.Fatalf("expected err!")
+	}
+	if !vn.isolated {
+		t.Fatalf("vnode should stay isolated")
+	}
+}
+
+// A ring whose remote peers all vanish must heal into a local ring
+func TestRingRecoverAfterPeerLoss(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	// Create a second ring
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	conf2.NumSuccessors = 2
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+
+	// Wait for some stabilization
+	<-time.After(100 * time.Millisecond)
+
+	// Node 1 disappears without leaving
+	r.Shutdown()
+	ml.DeregisterHost("test")
+
+	// Wait for recovery
+	<-time.After(300 * time.Millisecond)
+
+	num := len(r2.vnodes)
+	for idx, vn := range r2.vnodes {
+		if succ := vn.successor(); succ != &r2.vnodes[(idx+1)%num].Vnode {
+			t.Fatalf("bad successor! Got:%s", succ)
+		}
+	}
+	r2.Shutdown()
+}
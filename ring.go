@@ -2,27 +2,42 @@ package chord
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 	"sort"
 )
 
-func (r *Ring) init(conf *Config, trans Transport) {
+func (r *Ring) init(conf *Config, trans Transport) error {
 	// Set our variables
 	r.config = conf
+	r.stopped = make(chan struct{})
 	r.vnodes = make([]*localVnode, conf.NumVnodes)
-	r.transport = InitLocalTransport(trans)
-	r.delegateCh = make(chan func(), 32)
+	lt := InitLocalTransport(trans).(*LocalTransport)
+	lt.observe = r.recordRTT
+	r.transport = lt
 
 	// Initializes the vnodes
 	for i := 0; i < conf.NumVnodes; i++ {
 		vn := &localVnode{}
 		r.vnodes[i] = vn
 		vn.ring = r
-		vn.init(i)
+		if err := vn.init(i); err != nil {
+			r.deregisterVnodes()
+			return err
+		}
 	}
 
 	// Sort the vnodes
 	sort.Sort(r)
+
+	// Make sure the IDs are unique
+	for i := 1; i < len(r.vnodes); i++ {
+		if bytes.Equal(r.vnodes[i-1].Id, r.vnodes[i].Id) {
+			r.deregisterVnodes()
+			return fmt.Errorf("local vnodes share ID %s", r.vnodes[i].StringID())
+		}
+	}
+	return nil
 }
 
 // Len is the number of vnodes
@@ -43,6 +58,8 @@ func (r *Ring) Swap(i, j int) {
 
 // Returns the nearest local vnode to the key
 func (r *Ring) nearestVnode(key []byte) *localVnode {
+	r.vnodeLock.RLock()
+	defer r.vnodeLock.RUnlock()
 	for i := len(r.vnodes) - 1; i >= 0; i-- {
 		if bytes.Compare(r.vnodes[i].Id, key) == -1 {
 			return r.vnodes[i]
@@ -52,31 +69,140 @@ func (r *Ring) nearestVnode(key []byte) *localVnode {
 	return r.vnodes[len(r.vnodes)-1]
 }
 
+// Returns the local vnode following vn in the ring, nil if vn is the only one
+func (r *Ring) nextLocalVnode(vn *localVnode) *localVnode {
+	r.vnodeLock.RLock()
+	defer r.vnodeLock.RUnlock()
+	for i, v := range r.vnodes {
+		if v == vn && len(r.vnodes) > 1 {
+			return r.vnodes[(i+1)%len(r.vnodes)]
+		}
+	}
+	return nil
+}
+
 // Schedules each vnode in the ring
 func (r *Ring) schedule() {
-	if r.config.Delegate != nil {
-		go r.delegateHandler()
-	}
+	r.startDelegate()
 	for i := 0; i < len(r.vnodes); i++ {
 		r.vnodes[i].schedule()
 	}
 }
 
+// Starts the delegate handler and does a fast stabilization of the vnodes
+// once they have successors in an existing ring.  Stabilizing schedules the
+// regular execution.
+func (r *Ring) startJoined() {
+	r.startDelegate()
+	for _, vn := range r.vnodes {
+		vn.stabilize()
+	}
+	r.setState(StateActive)
+}
+
 // Wait for all the vnodes to shutdown
 func (r *Ring) stopVnodes() {
-	r.shutdown = make(chan bool, r.config.NumVnodes)
-	for i := 0; i < r.config.NumVnodes; i++ {
-		<-r.shutdown
+	r.resizeLock.Lock()
+	defer r.resizeLock.Unlock()
+
+	numV := len(r.localVnodes())
+	shutdown := make(chan bool, numV)
+	r.lock.Lock()
+	r.shutdown = shutdown
+	r.lock.Unlock()
+	for i := 0; i < numV; i++ {
+		<-shutdown
+	}
+}
+
+// Removes a vnode from the transport
+func (r *Ring) deregister(vn *localVnode) {
+	if d, ok := r.transport.(deregisterer); ok {
+		d.Deregister(&vn.Vnode)
+	}
+}
+
+// Removes every local vnode from the transport when a ring fails to start
+func (r *Ring) deregisterVnodes() {
+	for _, vn := range r.vnodes {
+		if vn != nil && vn.Id != nil {
+			r.deregister(vn)
+		}
+	}
+}
+
+// Returns a copy of the local vnodes, in ring order
+func (r *Ring) localVnodes() []*localVnode {
+	r.vnodeLock.RLock()
+	defer r.vnodeLock.RUnlock()
+	vnodes := make([]*localVnode, len(r.vnodes))
+	copy(vnodes, r.vnodes)
+	return vnodes
+}
+
+// Returns the shutdown channel if the vnodes are being stopped
+func (r *Ring) shutdownCh() chan bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.shutdown
+}
+
+// Events invoking the methods of the Delegate interface
+var delegateEvents = []EventType{
+	EventNewPredecessor, EventLeaving, EventPredecessorLeaving, EventSuccessorLeaving,
+}
+
+// Subscribes the delegate to the events of the interfaces it implements and
+// starts the handler invoking it.  The Delegate methods must see every event,
+// so they block the ring when the delegate falls behind.  The events of the
+// optional interfaces are coalesced instead.
+func (r *Ring) startDelegate() {
+	d := r.config.Delegate
+	if d == nil {
+		return
+	}
+	types := append([]EventType{}, delegateEvents...)
+	if _, ok := d.(SuccessorDelegate); ok {
+		types = append(types, EventSuccessorsChanged, EventFingerChanged)
+	}
+	if _, ok := d.(OwnershipDelegate); ok {
+		types = append(types, EventRangeGained, EventRangeLost)
 	}
+	if _, ok := d.(RecoveryDelegate); ok {
+		types = append(types, EventIsolated, EventRecovered)
+	}
+
+	s := newSubscriber(EventFilter{Types: types, Buffer: defaultEventBuffer, Overflow: OverflowCoalesce})
+	s.blocking = make(map[EventType]bool, len(delegateEvents))
+	for _, t := range delegateEvents {
+		s.blocking[t] = true
+	}
+	r.events.add(s)
+	r.delegateLock.Lock()
+	r.delegateSub = s
+	r.delegateLock.Unlock()
+	go r.delegateHandler(s.out)
 }
 
-// Stops the delegate handler
+// Stops the delegate handler and closes the subscriptions
 func (r *Ring) stopDelegate() {
 	if r.config.Delegate != nil {
 		// Wait for all delegate messages to be processed
-		<-r.invokeDelegate(r.config.Delegate.Shutdown)
-		close(r.delegateCh)
+		if ch := r.invokeDelegate(r.config.Delegate.Shutdown); ch != nil {
+			<-ch
+		}
+		r.delegateLock.Lock()
+		if r.delegateSub != nil {
+			r.delegateSub.cancel()
+			r.events.unsubscribe(r.delegateSub)
+			r.delegateSub = nil
+		}
+		r.delegateLock.Unlock()
 	}
+
+	// Let the subscribers know there is nothing more coming
+	r.publish(Event{Type: EventShutdown})
+	r.events.close()
 }
 
 // Initializes the vnodes with their local successors
@@ -84,9 +210,11 @@ func (r *Ring) setLocalSuccessors() {
 	numV := len(r.vnodes)
 	numSuc := min(r.config.NumSuccessors, numV-1)
 	for idx, vnode := range r.vnodes {
+		vnode.lock.Lock()
 		for i := 0; i < numSuc; i++ {
 			vnode.successors[i] = &r.vnodes[(idx+i+1)%numV].Vnode
 		}
+		vnode.lock.Unlock()
 	}
 }
 
@@ -104,18 +232,67 @@ func (r *Ring) invokeDelegate(f func()) chan struct{} {
 		f()
 	}
 
-	r.delegateCh <- wrapper
+	// RPC handlers may still fire once the delegate is stopped
+	r.delegateLock.RLock()
+	defer r.delegateLock.RUnlock()
+	if r.delegateSub == nil {
+		return nil
+	}
+	r.delegateSub.push(Event{fn: wrapper})
 	return ch
 }
 
 // This handler runs in a go routine to invoke methods on the delegate
-func (r *Ring) delegateHandler() {
-	for {
-		f, ok := <-r.delegateCh
-		if !ok {
-			break
+func (r *Ring) delegateHandler(events <-chan Event) {
+	for ev := range events {
+		ev := ev
+		r.safeInvoke(func() {
+			r.callDelegate(&ev)
+		})
+	}
+}
+
+// Invokes the delegate method matching an event
+func (r *Ring) callDelegate(ev *Event) {
+	if ev.fn != nil {
+		ev.fn()
+		return
+	}
+
+	d := r.config.Delegate
+	switch ev.Type {
+	case EventNewPredecessor:
+		d.NewPredecessor(ev.Local, ev.Remote, ev.Prev)
+	case EventLeaving:
+		d.Leaving(ev.Local, ev.Prev, ev.Remote)
+	case EventPredecessorLeaving:
+		d.PredecessorLeaving(ev.Local, ev.Remote)
+	case EventSuccessorLeaving:
+		d.SuccessorLeaving(ev.Local, ev.Remote)
+	case EventSuccessorsChanged:
+		if sd, ok := d.(SuccessorDelegate); ok {
+			sd.SuccessorsChanged(ev.Local, ev.PrevSuccessors, ev.Successors)
+		}
+	case EventFingerChanged:
+		if sd, ok := d.(SuccessorDelegate); ok {
+			sd.FingerChanged(ev.Local, *ev.Finger, ev.Prev)
+		}
+	case EventRangeGained:
+		if od, ok := d.(OwnershipDelegate); ok {
+			od.RangeGained(ev.Local, ev.Range, ev.Prev)
+		}
+	case EventRangeLost:
+		if od, ok := d.(OwnershipDelegate); ok {
+			od.RangeLost(ev.Local, ev.Range)
+		}
+	case EventIsolated:
+		if rd, ok := d.(RecoveryDelegate); ok {
+			rd.Isolated(ev.Local)
+		}
+	case EventRecovered:
+		if rd, ok := d.(RecoveryDelegate); ok {
+			rd.Recovered(ev.Local, ev.Source, ev.Successors)
 		}
-		r.safeInvoke(f)
 	}
 }
 
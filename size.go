@@ -0,0 +1,123 @@
+package chord
+
+import (
+	"math"
+	"math/big"
+
+	context "golang.org/x/net/context"
+)
+
+// SizeEstimate is the number of vnodes and hosts in the ring
+type SizeEstimate struct {
+	Vnodes int  // Number of vnodes in the ring
+	Hosts  int  // Number of hosts in the ring
+	Exact  bool // Counted by walking the whole ring
+}
+
+// EstimateSize estimates the size of the ring from the density of the local
+// successor lists, without any RPCs.  Each list covers a known number of
+// vnodes over a known span of the key space, so the vnodes of the whole ring
+// are the sampled vnodes scaled up to the full space.  The hosts are the
+// vnodes divided by the vnodes of the local host, assuming every host runs as
+// many.  Use ExactSize for exact counts.
+func (r *Ring) EstimateSize() *SizeEstimate {
+	hb := r.config.hashBits
+	vnodes := make(map[string]bool)
+	hosts := make(map[string]bool)
+	span := new(big.Int)
+	count := 0
+	wrapped := false
+
+	local := r.localVnodes()
+	for _, vn := range local {
+		vnodes[vn.StringID()] = true
+		hosts[vn.Host] = true
+
+		var last *Vnode
+		n := 0
+		for _, s := range vn.successorList(true) {
+			// A list wrapping around the ring holds all of it
+			if s.StringID() == vn.StringID() {
+				wrapped = true
+				break
+			}
+			vnodes[s.StringID()] = true
+			hosts[s.Host] = true
+			last = s
+			n++
+		}
+		if last != nil {
+			span.Add(span, distance(vn.Id, last.Id, hb))
+			count += n
+		}
+	}
+
+	est := &SizeEstimate{Vnodes: len(vnodes), Hosts: len(hosts)}
+	if wrapped || count == 0 || span.Sign() == 0 {
+		return est
+	}
+
+	// Vnodes per unit of key space, over the whole space
+	ring := new(big.Int).Lsh(big.NewInt(1), uint(hb))
+	density := new(big.Float).Quo(new(big.Float).SetInt(ring), new(big.Float).SetInt(span))
+	total, _ := density.Mul(density, big.NewFloat(float64(count))).Float64()
+	if n := int(math.Floor(total + 0.5)); n > est.Vnodes {
+		est.Vnodes = n
+	}
+	if n := int(math.Floor(float64(est.Vnodes)/float64(len(local)) + 0.5)); n > est.Hosts {
+		est.Hosts = n
+	}
+	return est
+}
+
+// ExactSize counts the vnodes and hosts of the ring by walking it.  The ring
+// is always walked, the walk refreshes the result cached by Members.
+func (r *Ring) ExactSize(ctx context.Context) (*SizeEstimate, error) {
+	m, err := r.RefreshMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SizeEstimate{Vnodes: len(m.Vnodes), Hosts: len(m.Hosts), Exact: true}, nil
+}
+
+// KeyspaceShare returns the fraction of the key space owned by each host,
+// found by walking the ring as ExactSize does.  Each vnode owns the keys from
+// its predecessor up to its own ID.  Hosts get their IDs from hashing their
+// names, so the shares show how evenly the keys are spread.
+func (r *Ring) KeyspaceShare(ctx context.Context) (map[string]float64, error) {
+	m, err := r.RefreshMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keyspaceShare(m.Vnodes, r.config.hashBits), nil
+}
+
+// Returns the share of the key space of each host given every vnode of the
+// ring sorted by ID
+func keyspaceShare(vnodes []*Member, bits int) map[string]float64 {
+	shares := make(map[string]float64)
+	if len(vnodes) == 0 {
+		return shares
+	}
+	if len(vnodes) == 1 {
+		shares[vnodes[0].Vnode.Host] = 1
+		return shares
+	}
+
+	ring := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	owned := make(map[string]*big.Int)
+	prev := vnodes[len(vnodes)-1].Vnode
+	for _, member := range vnodes {
+		vn := member.Vnode
+		if owned[vn.Host] == nil {
+			owned[vn.Host] = new(big.Int)
+		}
+		owned[vn.Host].Add(owned[vn.Host], distance(prev.Id, vn.Id, bits))
+		prev = vn
+	}
+	for host, keys := range owned {
+		share := new(big.Float).SetInt(keys)
+		shares[host], _ = share.Quo(share, ring).Float64()
+	}
+	return shares
+}
@@ -0,0 +1,177 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+func TestEstimateSize(t *testing.T) {
+	ml := InitMLTransport()
+	rings := makeRings(t, ml, 4, memberSetup)
+	for _, r := range rings {
+		defer r.Shutdown()
+	}
+
+	for _, r := range rings {
+		est := r.EstimateSize()
+		if est.Exact {
+			t.Fatalf("estimate should not be exact")
+		}
+		if est.Vnodes < 24 || est.Vnodes > 40 || est.Hosts < 3 || est.Hosts > 5 {
+			t.Fatalf("bad estimate of %s: %+v", r.config.Hostname, est)
+		}
+	}
+
+	// The walk gives exact counts
+	est, err := rings[2].ExactSize(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if *est != (SizeEstimate{Vnodes: 32, Hosts: 4, Exact: true}) {
+		t.Fatalf("bad size %+v", est)
+	}
+}
+
+func TestExactSizeCached(t *testing.T) {
+	ml := InitMLTransport()
+	rings := makeRings(t, ml, 3, memberSetup)
+	for _, r := range rings {
+		defer r.Shutdown()
+	}
+	rings[0].config.MembersRefresh = time.Hour
+	if _, err := rings[0].Members(context.Background()); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	// A host joining after the members are cached is counted
+	conf := fastConf()
+	conf.Hostname = "test4"
+	r4, err := Join(conf, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r4.Shutdown()
+	waitStable(t, append(rings, r4)...)
+
+	est, err := rings[0].ExactSize(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if *est != (SizeEstimate{Vnodes: 32, Hosts: 4, Exact: true}) {
+		t.Fatalf("bad size %+v", est)
+	}
+	shares, err := rings[0].KeyspaceShare(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(shares) != 4 {
+		t.Fatalf("bad shares %v", shares)
+	}
+}
+
+func TestEstimateSizeLarge(t *testing.T) {
+	// A ring of many hosts with more vnodes per host than successors
+	const hosts = 500
+	conf := makeRing().config
+	conf.Hostname = "host0"
+	conf.NumVnodes = 16
+	ring := &Ring{}
+	if err := ring.init(conf, nil); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	all := make([]*Vnode, 0, hosts*conf.NumVnodes)
+	for _, vn := range ring.vnodes {
+		all = append(all, &vn.Vnode)
+	}
+	for h := 1; h < hosts; h++ {
+		other := *conf
+		other.Hostname = fmt.Sprintf("host%d", h)
+		for i := 0; i < other.NumVnodes; i++ {
+			id, err := HostnameIDGenerator{}.GenerateID(&other, i)
+			if err != nil {
+				t.Fatalf("unexpected err. %s", err)
+			}
+			all = append(all, &Vnode{Id: id, Host: other.Hostname})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return bytes.Compare(all[i].Id, all[j].Id) < 0
+	})
+
+	// Give each local vnode its true successors
+	for i, vn := range all {
+		if vn.Host != "host0" {
+			continue
+		}
+		local := ring.vnodes[sort.Search(len(ring.vnodes), func(j int) bool {
+			return bytes.Compare(ring.vnodes[j].Id, vn.Id) >= 0
+		})]
+		for j := range local.successors {
+			local.successors[j] = all[(i+j+1)%len(all)]
+		}
+	}
+
+	est := ring.EstimateSize()
+	if math.Abs(float64(est.Vnodes)/float64(len(all))-1) > 0.25 ||
+		math.Abs(float64(est.Hosts)/hosts-1) > 0.25 {
+		t.Fatalf("bad estimate %+v of %d vnodes in %d hosts", est, len(all), hosts)
+	}
+}
+
+func TestEstimateSizeWrapped(t *testing.T) {
+	// Successor lists longer than the ring hold all of it
+	ring := makeVerifyRing()
+	est := ring.EstimateSize()
+	if est.Vnodes != 5 || est.Hosts != 1 {
+		t.Fatalf("bad estimate %+v", est)
+	}
+}
+
+func TestKeyspaceShare(t *testing.T) {
+	member := func(id byte, host string) *Member {
+		return &Member{Vnode: &Vnode{Id: []byte{id}, Host: host}}
+	}
+
+	// The first vnode owns the keys wrapping around the ring
+	shares := keyspaceShare([]*Member{
+		member(32, "a"),
+		member(96, "b"),
+		member(128, "a"),
+	}, 8)
+	if shares["a"] != 0.75 || shares["b"] != 0.25 {
+		t.Fatalf("bad shares %v", shares)
+	}
+
+	shares = keyspaceShare([]*Member{member(7, "a")}, 8)
+	if shares["a"] != 1 {
+		t.Fatalf("bad shares %v", shares)
+	}
+
+	// The shares of a real ring add up to the whole space
+	ml := InitMLTransport()
+	rings := makeRings(t, ml, 3, memberSetup)
+	for _, r := range rings {
+		defer r.Shutdown()
+	}
+	shares, err := rings[0].KeyspaceShare(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	total := 0.0
+	for host, share := range shares {
+		if share <= 0 || share >= 1 {
+			t.Fatalf("bad share of %s: %v", host, share)
+		}
+		total += share
+	}
+	if len(shares) != 3 || math.Abs(total-1) > 1e-9 {
+		t.Fatalf("bad shares %v", shares)
+	}
+}
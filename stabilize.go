@@ -0,0 +1,148 @@
+package chord
+
+import (
+	"math/rand"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// StabilizeStats are the stabilization interval and the routing state change
+// counters of a vnode
+type StabilizeStats struct {
+	Interval     time.Duration // Base delay until the next stabilization
+	Rounds       uint64        // Stabilizations completed
+	Successors   uint64        // Changes of the successor list
+	Predecessors uint64        // Changes of the predecessor
+	Fingers      uint64        // Changes of finger table runs
+	QuietRounds  uint64        // Rounds completed since the successor list changed
+}
+
+// Kinds of routing state changes counted
+type stateChange int
+
+const (
+	changeSuccessors stateChange = iota
+	changePredecessor
+	changeFingers
+)
+
+// Counts a change of the routing state.  With adaptive stabilization a vnode
+// backed off while quiet is rescheduled to stabilize fast.
+func (vn *localVnode) noteChange(kind stateChange) {
+	vn.lock.Lock()
+	defer vn.lock.Unlock()
+	switch kind {
+	case changeSuccessors:
+		vn.stats.Successors++
+		vn.succChanged = true
+	case changePredecessor:
+		vn.stats.Predecessors++
+	case changeFingers:
+		vn.stats.Fingers++
+	}
+	vn.churn = true
+
+	conf := vn.ring.config
+	if !conf.AdaptiveStabilize || vn.stats.Interval <= conf.StabilizeMin {
+		return
+	}
+	if vn.timer != nil && vn.stopCh == nil && vn.timer.Stop() {
+		vn.stats.Interval = conf.StabilizeMin
+		vn.timer = time.AfterFunc(jitterStabilize(conf.StabilizeMin), vn.stabilize)
+	}
+}
+
+// Returns the delay until the next stabilization, must be called with the
+// lock held.  Adaptive stabilization restarts from StabilizeMin after any
+// change and doubles the interval while quiet, up to StabilizeMax.
+func (vn *localVnode) nextStabilize() time.Duration {
+	conf := vn.ring.config
+	if !conf.AdaptiveStabilize {
+		vn.stats.Interval = conf.StabilizeMax
+		return randStabilize(conf)
+	}
+
+	if vn.churn || vn.stats.Interval == 0 {
+		vn.stats.Interval = conf.StabilizeMin
+	} else if vn.stats.Interval *= 2; vn.stats.Interval > conf.StabilizeMax {
+		vn.stats.Interval = conf.StabilizeMax
+	}
+	vn.churn = false
+	return jitterStabilize(vn.stats.Interval)
+}
+
+// Spreads a stabilization interval by a quarter either way so the vnodes do
+// not stabilize in lockstep
+func jitterStabilize(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.75 + rand.Float64()/2))
+}
+
+// Counts a completed stabilization round, must be called with the lock held
+func (vn *localVnode) countRound() {
+	vn.stats.Rounds++
+	if vn.succChanged {
+		vn.stats.QuietRounds = 0
+		vn.succChanged = false
+	} else {
+		vn.stats.QuietRounds++
+	}
+}
+
+// WaitStable blocks until the local view of the ring converged: every local
+// vnode has a predecessor, is the predecessor of its successor, and kept the
+// same successor list for Config.StableRounds stabilization rounds.  Returns a
+// StateError if the ring is leaving or stopped.
+func (r *Ring) WaitStable(ctx context.Context) error {
+	events, cancel := r.Subscribe(EventFilter{Types: []EventType{EventStabilized}, Overflow: OverflowCoalesce})
+	defer cancel()
+
+	for {
+		if state := r.State(); state == StateLeaving || state == StateStopped {
+			return &StateError{Op: "wait for", State: state}
+		}
+		stable := true
+		for _, vn := range r.localVnodes() {
+			if !vn.stable(ctx) {
+				stable = false
+				break
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if stable {
+			return nil
+		}
+
+		// Check again after the next stabilization
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-events:
+			if !ok {
+				return &StateError{Op: "wait for", State: r.State()}
+			}
+		}
+	}
+}
+
+// Returns whether a vnode converged
+func (vn *localVnode) stable(ctx context.Context) bool {
+	rounds := uint64(vn.ring.config.StableRounds)
+	if rounds < 1 {
+		rounds = 1
+	}
+	vn.lock.RLock()
+	pred := vn.predecessor
+	succ := vn.successors[0]
+	quiet := vn.stats.QuietRounds
+	vn.lock.RUnlock()
+	if pred == nil || succ == nil || quiet < rounds {
+		return false
+	}
+
+	// Our successor must agree we are its predecessor
+	back, err := vn.ring.transport.GetPredecessor(ctx, succ)
+	return err == nil && back != nil && back.StringID() == vn.StringID()
+}
@@ -0,0 +1,171 @@
+package chord
+
+import (
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+func makeAdaptiveVnode(min, max time.Duration) *localVnode {
+	vn := makeVnode()
+	vn.ring.config.StabilizeMin = min
+	vn.ring.config.StabilizeMax = max
+	vn.ring.config.AdaptiveStabilize = true
+	return vn
+}
+
+func TestNextStabilize(t *testing.T) {
+	vn := makeAdaptiveVnode(10*time.Millisecond, 80*time.Millisecond)
+
+	// Backs off exponentially while quiet
+	for _, expect := range []time.Duration{10, 20, 40, 80, 80} {
+		expect *= time.Millisecond
+		d := vn.nextStabilize()
+		if vn.stats.Interval != expect {
+			t.Fatalf("expected interval %s, got %s", expect, vn.stats.Interval)
+		}
+		if d < expect*3/4 || d > expect*5/4 {
+			t.Fatalf("delay %s out of the jitter of %s", d, expect)
+		}
+	}
+
+	// Any change brings it back to the minimum
+	vn.churn = true
+	vn.nextStabilize()
+	if vn.stats.Interval != 10*time.Millisecond || vn.churn {
+		t.Fatalf("expected the minimum interval, got %s", vn.stats.Interval)
+	}
+}
+
+func TestNextStabilizeFixed(t *testing.T) {
+	vn := makeVnode()
+	conf := vn.ring.config
+	for i := 0; i < 100; i++ {
+		if d := vn.nextStabilize(); d < conf.StabilizeMin || d > conf.StabilizeMax {
+			t.Fatalf("delay %s out of bounds", d)
+		}
+	}
+}
+
+func TestNoteChangeReschedules(t *testing.T) {
+	vn := makeAdaptiveVnode(time.Minute, time.Hour)
+	vn.stats.Interval = time.Hour
+	timer := time.AfterFunc(time.Hour, func() {})
+	vn.timer = timer
+
+	vn.noteChange(changePredecessor)
+	vn.noteChange(changeFingers)
+	vn.noteChange(changeFingers)
+	defer vn.timer.Stop()
+
+	if vn.timer == timer || vn.stats.Interval != time.Minute || !vn.churn {
+		t.Fatalf("expected the vnode to be rescheduled")
+	}
+	if vn.stats.Predecessors != 1 || vn.stats.Fingers != 2 || vn.stats.Successors != 0 {
+		t.Fatalf("bad counters %+v", vn.stats)
+	}
+}
+
+func TestAdaptiveStabilize(t *testing.T) {
+	ml := InitMLTransport()
+	conf := fastConf()
+	conf.AdaptiveStabilize = true
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	conf2.AdaptiveStabilize = true
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	// Changes were counted while joining
+	for _, info := range r2.Vnodes() {
+		if info.Stabilize.Rounds == 0 || info.Stabilize.Successors == 0 || info.Stabilize.Fingers == 0 {
+			t.Fatalf("bad stats of %s: %+v", info.Vnode, info.Stabilize)
+		}
+	}
+
+	// Backs off once the ring is quiet
+	for i := 0; ; i++ {
+		quiet := true
+		for _, info := range r.Vnodes() {
+			quiet = quiet && info.Stabilize.Interval == conf.StabilizeMax
+		}
+		if quiet {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("ring did not back off")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCountRound(t *testing.T) {
+	vn := makeVnode()
+	vn.countRound()
+	vn.countRound()
+	if vn.stats.Rounds != 2 || vn.stats.QuietRounds != 2 {
+		t.Fatalf("bad counters %+v", vn.stats)
+	}
+
+	// A change restarts the quiet rounds
+	vn.noteChange(changeSuccessors)
+	vn.countRound()
+	if vn.stats.Rounds != 3 || vn.stats.QuietRounds != 0 {
+		t.Fatalf("bad counters %+v", vn.stats)
+	}
+	vn.countRound()
+	if vn.stats.QuietRounds != 1 {
+		t.Fatalf("bad counters %+v", vn.stats)
+	}
+}
+
+func TestWaitStable(t *testing.T) {
+	ml := InitMLTransport()
+	r, err := Create(fastConf(), ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+
+	// Gives up with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.WaitStable(ctx); err != context.Canceled {
+		t.Fatalf("expected canceled err. Got %v", err)
+	}
+
+	// Converged once it returns
+	waitStable(t, r, r2)
+	if err := checkRingOrder(r, r2); err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	for _, info := range r2.Vnodes() {
+		if info.Stabilize.QuietRounds < uint64(conf2.StableRounds) {
+			t.Fatalf("bad quiet rounds of %s: %+v", info.Vnode, info.Stabilize)
+		}
+	}
+
+	// A stopped ring never stabilizes
+	r.Shutdown()
+	if _, ok := r.WaitStable(context.Background()).(*StateError); !ok {
+		t.Fatalf("expected state err")
+	}
+}
@@ -0,0 +1,100 @@
+package chord
+
+import (
+	"sync"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+// traceKey is the context key holding the trace of a lookup
+type traceKey struct{}
+
+// lookupTrace collects the hops of a traced lookup in the order they are
+// tried.  A hop is added before its call is made and completed once the call
+// returns, so the hops of later calls follow it.
+type lookupTrace struct {
+	lock sync.Mutex
+	hops []*TraceHop
+}
+
+// Returns a context carrying the trace
+func withTrace(ctx context.Context, t *lookupTrace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// Returns the trace carried by the context, nil if the lookup is not traced
+func traceFrom(ctx context.Context) *lookupTrace {
+	t, _ := ctx.Value(traceKey{}).(*lookupTrace)
+	return t
+}
+
+// Adds a hop for a call about to be made to a vnode.  Safe to call on a nil
+// trace.
+func (t *lookupTrace) begin(vn *Vnode, fallback bool) *TraceHop {
+	if t == nil {
+		return nil
+	}
+	hop := &TraceHop{Vnode: copyVnode(vn), Fallback: fallback}
+	t.lock.Lock()
+	t.hops = append(t.hops, hop)
+	t.lock.Unlock()
+	return hop
+}
+
+// Completes a hop with the latency and error of its call
+func (t *lookupTrace) end(hop *TraceHop, start time.Time, err error) {
+	if t == nil || hop == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	hop.Latency = int64(time.Since(start))
+	if err != nil {
+		hop.Error = err.Error()
+	}
+}
+
+// Appends the hops returned by a remote host
+func (t *lookupTrace) extend(hops []*TraceHop) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	t.hops = append(t.hops, hops...)
+	t.lock.Unlock()
+}
+
+// Returns a copy of the hops recorded so far
+func (t *lookupTrace) list() []*TraceHop {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	hops := make([]*TraceHop, len(t.hops))
+	for i, hop := range t.hops {
+		h := *hop
+		hops[i] = &h
+	}
+	return hops
+}
+
+// LookupTrace does a lookup for the successor of the hash of a key and records
+// every vnode the lookup went through.  It returns the hash of the key, the
+// successor and the hops in the order they were tried.  The hops are returned
+// even when the lookup fails.
+//
+// The first hop is the nearest local vnode.  Each hop has the vnode and host
+// asked, the latency of the call in nanoseconds including the hops after it,
+// and the error if the call failed.  A hop tried only because an earlier one
+// failed is marked as a fallback.  A fallback hop to the vnode making the
+// previous call means it answered from its own successor list.
+func (r *Ring) LookupTrace(key []byte) ([]byte, []*Vnode, []*TraceHop, error) {
+	return r.LookupTraceContext(context.Background(), key)
+}
+
+// LookupTraceContext is the same as LookupTrace but the context is passed
+// through to every hop of the lookup.
+func (r *Ring) LookupTraceContext(ctx context.Context, key []byte) ([]byte, []*Vnode, []*TraceHop, error) {
+	trace := &lookupTrace{}
+	kh, _, succs, err := r.LookupContext(withTrace(ctx, trace), 1, key)
+	return kh, succs, trace.list(), err
+}
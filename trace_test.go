@@ -0,0 +1,112 @@
+package chord
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+func TestLookupTrace(t *testing.T) {
+	// Create a multi transport
+	ml := InitMLTransport()
+
+	// Create the initial ring
+	conf := fastConf()
+	r, err := Create(conf, ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	// Create a second ring
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitRingOrder(t, r, r2)
+
+	keys := [][]byte{[]byte("test"), []byte("foo"), []byte("bar")}
+	for _, k := range keys {
+		_, _, exp, err := r.Lookup(1, k)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+
+		kh, succs, hops, err := r.LookupTrace(k)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		if kh == nil || len(succs) != 1 || succs[0].StringID() != exp[0].StringID() {
+			t.Fatalf("bad lookup result")
+		}
+		if len(hops) == 0 {
+			t.Fatalf("missing hops")
+		}
+		if hops[0].Vnode.Host != "test" || hops[0].Fallback {
+			t.Fatalf("first hop should be the nearest local vnode")
+		}
+		for _, hop := range hops {
+			if hop.Error != "" || hop.Latency <= 0 {
+				t.Fatalf("bad hop %v", hop)
+			}
+		}
+	}
+}
+
+func TestVnodeFindSuccessorsTraceFallback(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+	num := len(r.vnodes)
+	for i := 0; i < num; i++ {
+		r.vnodes[i].successors[0] = &r.vnodes[(i+1)%num].Vnode
+		r.vnodes[i].successors[1] = &r.vnodes[(i+2)%num].Vnode
+	}
+
+	// Kill 2 of the nodes
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[0].Vnode)
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[3].Vnode)
+
+	// Get a random key
+	h := r.config.HashFunc()
+	h.Write([]byte("test"))
+	key := h.Sum(nil)
+
+	// Some lookup must fail over a dead vnode
+	failed := false
+	for i := 0; i < num; i++ {
+		trace := &lookupTrace{}
+		ctx := withTrace(context.Background(), trace)
+		if _, err := r.vnodes[i].FindSuccessors(ctx, 1, key); err != nil {
+			t.Fatalf("(%d) unexpected err! %s", i, err)
+		}
+
+		hops := trace.list()
+		for j, hop := range hops {
+			if hop.Error == "" {
+				continue
+			}
+			failed = true
+			if j+1 == len(hops) || !hops[j+1].Fallback {
+				t.Fatalf("(%d) failed hop not followed by a fallback", i)
+			}
+		}
+	}
+	if !failed {
+		t.Fatalf("expected a failed hop")
+	}
+}
+
+func TestLookupTraceNotTraced(t *testing.T) {
+	var trace *lookupTrace
+	if traceFrom(context.Background()) != nil {
+		t.Fatalf("unexpected trace")
+	}
+	// A nil trace ignores hops
+	trace.end(trace.begin(&Vnode{Id: []byte{1}}, false), time.Now(), nil)
+	trace.extend([]*TraceHop{{}})
+}
@@ -3,6 +3,9 @@ package chord
 import (
 	"fmt"
 	"sync"
+	"time"
+
+	context "golang.org/x/net/context"
 )
 
 // Wraps vnode and object
@@ -15,10 +18,11 @@ type localRPC struct {
 // locally using direct method calls. For any non-local vnodes, the
 // request is passed on to another transport.
 type LocalTransport struct {
-	host   string
-	remote Transport
-	lock   sync.RWMutex
-	local  map[string]*localRPC
+	host    string
+	remote  Transport
+	lock    sync.RWMutex
+	local   map[string]*localRPC
+	observe func(host string, rtt time.Duration) // Told the round trip time of single hop remote calls
 }
 
 // InitLocalTransport creates a local transport to wrap a remote transport
@@ -45,14 +49,14 @@ func (lt *LocalTransport) get(vn *Vnode) (VnodeRPC, bool) {
 	}
 }
 
-func (lt *LocalTransport) ListVnodes(host string) ([]*Vnode, error) {
+func (lt *LocalTransport) ListVnodes(ctx context.Context, host string) ([]*Vnode, error) {
 	// Check if this is a local host
+	lt.lock.RLock()
 	if host == lt.host {
 		// Generate all the local clients
 		res := make([]*Vnode, 0, len(lt.local))
 
 		// Build list
-		lt.lock.RLock()
 		for _, v := range lt.local {
 			res = append(res, v.vnode)
 		}
@@ -60,12 +64,24 @@ func (lt *LocalTransport) ListVnodes(host string) ([]*Vnode, error) {
 
 		return res, nil
 	}
+	lt.lock.RUnlock()
 
 	// Pass onto remote
-	return lt.remote.ListVnodes(host)
+	start := time.Now()
+	res, err := lt.remote.ListVnodes(ctx, host)
+	lt.measure(host, start, err)
+	return res, err
+}
+
+// Reports the round trip time of a successful remote call.  Recursive
+// lookups are not measured as they include the time of the further hops.
+func (lt *LocalTransport) measure(host string, start time.Time, err error) {
+	if err == nil && lt.observe != nil {
+		lt.observe(host, time.Since(start))
+	}
 }
 
-func (lt *LocalTransport) Ping(vn *Vnode) (bool, error) {
+func (lt *LocalTransport) Ping(ctx context.Context, vn *Vnode) (bool, error) {
 	// Look for it locally
 	_, ok := lt.get(vn)
 
@@ -75,72 +91,87 @@ func (lt *LocalTransport) Ping(vn *Vnode) (bool, error) {
 	}
 
 	// Pass onto remote
-	return lt.remote.Ping(vn)
+	start := time.Now()
+	res, err := lt.remote.Ping(ctx, vn)
+	lt.measure(vn.Host, start, err)
+	return res, err
 }
 
-func (lt *LocalTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
+func (lt *LocalTransport) GetPredecessor(ctx context.Context, vn *Vnode) (*Vnode, error) {
 	// Look for it locally
 	obj, ok := lt.get(vn)
 
 	// If it exists locally, handle it
 	if ok {
-		return obj.GetPredecessor()
+		return obj.GetPredecessor(ctx)
 	}
 
 	// Pass onto remote
-	return lt.remote.GetPredecessor(vn)
+	start := time.Now()
+	res, err := lt.remote.GetPredecessor(ctx, vn)
+	lt.measure(vn.Host, start, err)
+	return res, err
 }
 
-func (lt *LocalTransport) Notify(vn, self *Vnode) ([]*Vnode, error) {
+func (lt *LocalTransport) Notify(ctx context.Context, vn, self *Vnode) ([]*Vnode, error) {
 	// Look for it locally
 	obj, ok := lt.get(vn)
 
 	// If it exists locally, handle it
 	if ok {
-		return obj.Notify(self)
+		return obj.Notify(ctx, self)
 	}
 
 	// Pass onto remote
-	return lt.remote.Notify(vn, self)
+	start := time.Now()
+	res, err := lt.remote.Notify(ctx, vn, self)
+	lt.measure(vn.Host, start, err)
+	return res, err
 }
 
-func (lt *LocalTransport) FindSuccessors(vn *Vnode, n int, key []byte) ([]*Vnode, error) {
+func (lt *LocalTransport) FindSuccessors(ctx context.Context, vn *Vnode, n int, key []byte) ([]*Vnode, error) {
 	// Look for it locally
 	obj, ok := lt.get(vn)
 
 	// If it exists locally, handle it
 	if ok {
-		return obj.FindSuccessors(n, key)
+		return obj.FindSuccessors(ctx, n, key)
 	}
 
 	// Pass onto remote
-	return lt.remote.FindSuccessors(vn, n, key)
+	return lt.remote.FindSuccessors(ctx, vn, n, key)
 }
 
-func (lt *LocalTransport) ClearPredecessor(target, self *Vnode) error {
+func (lt *LocalTransport) ClearPredecessor(ctx context.Context, target, self *Vnode) error {
 	// Look for it locally
 	obj, ok := lt.get(target)
 
 	// If it exists locally, handle it
 	if ok {
-		return obj.ClearPredecessor(self)
+		return obj.ClearPredecessor(ctx, self)
 	}
 
 	// Pass onto remote
-	return lt.remote.ClearPredecessor(target, self)
+	start := time.Now()
+	err := lt.remote.ClearPredecessor(ctx, target, self)
+	lt.measure(target.Host, start, err)
+	return err
 }
 
-func (lt *LocalTransport) SkipSuccessor(target, self *Vnode) error {
+func (lt *LocalTransport) SkipSuccessor(ctx context.Context, target, self *Vnode) error {
 	// Look for it locally
 	obj, ok := lt.get(target)
 
 	// If it exists locally, handle it
 	if ok {
-		return obj.SkipSuccessor(self)
+		return obj.SkipSuccessor(ctx, self)
 	}
 
 	// Pass onto remote
-	return lt.remote.SkipSuccessor(target, self)
+	start := time.Now()
+	err := lt.remote.SkipSuccessor(ctx, target, self)
+	lt.measure(target.Host, start, err)
+	return err
 }
 
 func (lt *LocalTransport) Register(v *Vnode, o VnodeRPC) {
@@ -160,37 +191,83 @@ func (lt *LocalTransport) Deregister(v *Vnode) {
 	lt.lock.Lock()
 	delete(lt.local, key)
 	lt.lock.Unlock()
+
+	// Deregister with remote transport if it supports it
+	if d, ok := lt.remote.(deregisterer); ok {
+		d.Deregister(v)
+	}
+}
+
+func (lt *LocalTransport) ClosestPreceding(ctx context.Context, vn *Vnode, n int, key []byte) ([]*Vnode, []*Vnode, error) {
+	// Look for it locally
+	obj, ok := lt.get(vn)
+
+	// If it exists locally, handle it
+	if ok {
+		return obj.ClosestPreceding(ctx, n, key)
+	}
+
+	// Pass onto remote if it supports iterative lookups
+	if it, ok := lt.remote.(IterativeTransport); ok {
+		start := time.Now()
+		succs, closest, err := it.ClosestPreceding(ctx, vn, n, key)
+		lt.measure(vn.Host, start, err)
+		return succs, closest, err
+	}
+	return nil, nil, errIterativeUnsupported
+}
+
+func (lt *LocalTransport) FindSuccessorsBatch(ctx context.Context, vn *Vnode, n int, keys [][]byte) ([][]*Vnode, error) {
+	// Look for it locally
+	obj, ok := lt.get(vn)
+
+	// If it exists locally, handle it
+	if ok {
+		return obj.FindSuccessorsBatch(ctx, n, keys)
+	}
+
+	// Pass onto remote if it supports batched lookups
+	if bt, ok := lt.remote.(BatchTransport); ok {
+		return bt.FindSuccessorsBatch(ctx, vn, n, keys)
+	}
+	return nil, errBatchUnsupported
+}
+
+// deregisterer is implemented by transports that can stop serving a vnode
+// registered earlier
+type deregisterer interface {
+	Deregister(*Vnode)
 }
 
 // BlackholeTransport is used to provide an implemenation of the Transport that
 // does not actually do anything. Any operation will result in an error.
 type BlackholeTransport struct{}
 
-func (*BlackholeTransport) ListVnodes(host string) ([]*Vnode, error) {
+func (*BlackholeTransport) ListVnodes(ctx context.Context, host string) ([]*Vnode, error) {
 	return nil, fmt.Errorf("Failed to connect! Blackhole: %s.", host)
 }
 
-func (*BlackholeTransport) Ping(vn *Vnode) (bool, error) {
+func (*BlackholeTransport) Ping(ctx context.Context, vn *Vnode) (bool, error) {
 	return false, nil
 }
 
-func (*BlackholeTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
+func (*BlackholeTransport) GetPredecessor(ctx context.Context, vn *Vnode) (*Vnode, error) {
 	return nil, fmt.Errorf("Failed to connect! Blackhole: %s.", vn.StringID())
 }
 
-func (*BlackholeTransport) Notify(vn, self *Vnode) ([]*Vnode, error) {
+func (*BlackholeTransport) Notify(ctx context.Context, vn, self *Vnode) ([]*Vnode, error) {
 	return nil, fmt.Errorf("Failed to connect! Blackhole: %s", vn.StringID())
 }
 
-func (*BlackholeTransport) FindSuccessors(vn *Vnode, n int, key []byte) ([]*Vnode, error) {
+func (*BlackholeTransport) FindSuccessors(ctx context.Context, vn *Vnode, n int, key []byte) ([]*Vnode, error) {
 	return nil, fmt.Errorf("Failed to connect! Blackhole: %s", vn.StringID())
 }
 
-func (*BlackholeTransport) ClearPredecessor(target, self *Vnode) error {
+func (*BlackholeTransport) ClearPredecessor(ctx context.Context, target, self *Vnode) error {
 	return fmt.Errorf("Failed to connect! Blackhole: %s", target.StringID())
 }
 
-func (*BlackholeTransport) SkipSuccessor(target, self *Vnode) error {
+func (*BlackholeTransport) SkipSuccessor(ctx context.Context, target, self *Vnode) error {
 	return fmt.Errorf("Failed to connect! Blackhole: %s", target.StringID())
 }
 
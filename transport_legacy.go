@@ -0,0 +1,164 @@
+package chord
+
+import (
+	context "golang.org/x/net/context"
+)
+
+// LegacyTransport is the context-less transport interface.  Existing custom
+// transports implementing it can be used with a ring by wrapping them with
+// NewLegacyTransport.
+type LegacyTransport interface {
+	ListVnodes(string) ([]*Vnode, error)
+	Ping(*Vnode) (bool, error)
+	GetPredecessor(*Vnode) (*Vnode, error)
+	Notify(target, self *Vnode) ([]*Vnode, error)
+	FindSuccessors(*Vnode, int, []byte) ([]*Vnode, error)
+	ClearPredecessor(target, self *Vnode) error
+	SkipSuccessor(target, self *Vnode) error
+	Register(*Vnode, LegacyVnodeRPC)
+}
+
+// LegacyVnodeRPC is the context-less set of methods a LegacyTransport invokes
+// on registered vnodes.
+type LegacyVnodeRPC interface {
+	GetPredecessor() (*Vnode, error)
+	Notify(*Vnode) ([]*Vnode, error)
+	FindSuccessors(int, []byte) ([]*Vnode, error)
+	ClearPredecessor(*Vnode) error
+	SkipSuccessor(*Vnode) error
+}
+
+// legacyTransport adapts a LegacyTransport to the Transport interface.  The
+// wrapped calls cannot be interrupted, so the adapter stops waiting on them
+// once the context is done.
+type legacyTransport struct {
+	trans LegacyTransport
+}
+
+// NewLegacyTransport wraps a transport implementing the context-less
+// interface so it can be used to create or join a ring.
+func NewLegacyTransport(trans LegacyTransport) Transport {
+	return &legacyTransport{trans: trans}
+}
+
+// Runs f in a go routine returning early if the context is done first.  Any
+// results written by f may only be read when a nil error is returned.
+func (lt *legacyTransport) call(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- f()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errChan:
+		return err
+	}
+}
+
+func (lt *legacyTransport) ListVnodes(ctx context.Context, host string) ([]*Vnode, error) {
+	var res []*Vnode
+	err := lt.call(ctx, func() (err error) {
+		res, err = lt.trans.ListVnodes(host)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (lt *legacyTransport) Ping(ctx context.Context, vn *Vnode) (bool, error) {
+	var res bool
+	err := lt.call(ctx, func() (err error) {
+		res, err = lt.trans.Ping(vn)
+		return
+	})
+	if err != nil {
+		return false, err
+	}
+	return res, nil
+}
+
+func (lt *legacyTransport) GetPredecessor(ctx context.Context, vn *Vnode) (*Vnode, error) {
+	var res *Vnode
+	err := lt.call(ctx, func() (err error) {
+		res, err = lt.trans.GetPredecessor(vn)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (lt *legacyTransport) Notify(ctx context.Context, target, self *Vnode) ([]*Vnode, error) {
+	var res []*Vnode
+	err := lt.call(ctx, func() (err error) {
+		res, err = lt.trans.Notify(target, self)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (lt *legacyTransport) FindSuccessors(ctx context.Context, vn *Vnode, n int, key []byte) ([]*Vnode, error) {
+	var res []*Vnode
+	err := lt.call(ctx, func() (err error) {
+		res, err = lt.trans.FindSuccessors(vn, n, key)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (lt *legacyTransport) ClearPredecessor(ctx context.Context, target, self *Vnode) error {
+	return lt.call(ctx, func() error {
+		return lt.trans.ClearPredecessor(target, self)
+	})
+}
+
+func (lt *legacyTransport) SkipSuccessor(ctx context.Context, target, self *Vnode) error {
+	return lt.call(ctx, func() error {
+		return lt.trans.SkipSuccessor(target, self)
+	})
+}
+
+func (lt *legacyTransport) Register(v *Vnode, o VnodeRPC) {
+	lt.trans.Register(v, &legacyVnodeRPC{obj: o})
+}
+
+// legacyVnodeRPC exposes a VnodeRPC to a LegacyTransport.  Calls arriving
+// through the legacy transport carry no context of their own.
+type legacyVnodeRPC struct {
+	obj VnodeRPC
+}
+
+func (lv *legacyVnodeRPC) GetPredecessor() (*Vnode, error) {
+	return lv.obj.GetPredecessor(context.Background())
+}
+
+func (lv *legacyVnodeRPC) Notify(vn *Vnode) ([]*Vnode, error) {
+	return lv.obj.Notify(context.Background(), vn)
+}
+
+func (lv *legacyVnodeRPC) FindSuccessors(n int, key []byte) ([]*Vnode, error) {
+	return lv.obj.FindSuccessors(context.Background(), n, key)
+}
+
+func (lv *legacyVnodeRPC) ClearPredecessor(vn *Vnode) error {
+	return lv.obj.ClearPredecessor(context.Background(), vn)
+}
+
+func (lv *legacyVnodeRPC) SkipSuccessor(vn *Vnode) error {
+	return lv.obj.SkipSuccessor(context.Background(), vn)
+}
@@ -3,6 +3,9 @@ package chord
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
 )
 
 type MockVnodeRPC struct {
@@ -12,31 +15,45 @@ type MockVnodeRPC struct {
 	succ_list []*Vnode
 	key       []byte
 	succ      []*Vnode
+	closest   []*Vnode
 	skip      *Vnode
 }
 
-func (mv *MockVnodeRPC) GetPredecessor() (*Vnode, error) {
+func (mv *MockVnodeRPC) GetPredecessor(ctx context.Context) (*Vnode, error) {
 	return mv.pred, mv.err
 }
-func (mv *MockVnodeRPC) Notify(vn *Vnode) ([]*Vnode, error) {
+func (mv *MockVnodeRPC) Notify(ctx context.Context, vn *Vnode) ([]*Vnode, error) {
 	mv.not_pred = vn
 	return mv.succ_list, mv.err
 }
-func (mv *MockVnodeRPC) FindSuccessors(n int, key []byte) ([]*Vnode, error) {
+func (mv *MockVnodeRPC) FindSuccessors(ctx context.Context, n int, key []byte) ([]*Vnode, error) {
 	mv.key = key
 	return mv.succ, mv.err
 }
 
-func (mv *MockVnodeRPC) ClearPredecessor(p *Vnode) error {
+func (mv *MockVnodeRPC) ClearPredecessor(ctx context.Context, p *Vnode) error {
 	mv.pred = nil
 	return nil
 }
 
-func (mv *MockVnodeRPC) SkipSuccessor(s *Vnode) error {
+func (mv *MockVnodeRPC) SkipSuccessor(ctx context.Context, s *Vnode) error {
 	mv.skip = s
 	return nil
 }
 
+func (mv *MockVnodeRPC) FindSuccessorsBatch(ctx context.Context, n int, keys [][]byte) ([][]*Vnode, error) {
+	res := make([][]*Vnode, len(keys))
+	for i := range keys {
+		res[i] = mv.succ
+	}
+	return res, mv.err
+}
+
+func (mv *MockVnodeRPC) ClosestPreceding(ctx context.Context, n int, key []byte) ([]*Vnode, []*Vnode, error) {
+	mv.key = key
+	return mv.succ, mv.closest, mv.err
+}
+
 func makeLocal() *LocalTransport {
 	return InitLocalTransport(nil).(*LocalTransport)
 }
@@ -57,7 +74,7 @@ func TestLocalList(t *testing.T) {
 	mockVN := &MockVnodeRPC{}
 	l.Register(vn, mockVN)
 
-	list, err := l.ListVnodes("test")
+	list, err := l.ListVnodes(context.Background(), "test")
 	if err != nil {
 		t.Fatalf("unexpected err. %s", err)
 	}
@@ -72,7 +89,7 @@ func TestLocalListRemote(t *testing.T) {
 	mockVN := &MockVnodeRPC{}
 	l.Register(vn, mockVN)
 
-	_, err := l.ListVnodes("remote")
+	_, err := l.ListVnodes(context.Background(), "remote")
 	if err == nil {
 		t.Fatalf("expected err!")
 	}
@@ -83,7 +100,7 @@ func TestLocalPing(t *testing.T) {
 	vn := &Vnode{Id: []byte{1}}
 	mockVN := &MockVnodeRPC{}
 	l.Register(vn, mockVN)
-	if res, err := l.Ping(vn); !res || err != nil {
+	if res, err := l.Ping(context.Background(), vn); !res || err != nil {
 		t.Fatalf("local ping failed")
 	}
 }
@@ -96,7 +113,7 @@ func TestLocalMissingPing(t *testing.T) {
 
 	// Print some random node
 	vn2 := &Vnode{Id: []byte{3}}
-	if res, _ := l.Ping(vn2); res {
+	if res, _ := l.Ping(context.Background(), vn2); res {
 		t.Fatalf("ping succeeded")
 	}
 }
@@ -109,7 +126,7 @@ func TestLocalGetPredecessor(t *testing.T) {
 	l.Register(vn, mockVN)
 
 	vn2 := &Vnode{Id: []byte{42}}
-	res, err := l.GetPredecessor(vn2)
+	res, err := l.GetPredecessor(context.Background(), vn2)
 	if err != nil {
 		t.Fatalf("local GetPredecessor failed")
 	}
@@ -118,7 +135,7 @@ func TestLocalGetPredecessor(t *testing.T) {
 	}
 
 	unknown := &Vnode{Id: []byte{1}}
-	res, err = l.GetPredecessor(unknown)
+	res, err = l.GetPredecessor(context.Background(), unknown)
 	if err == nil {
 		t.Fatalf("expected error!")
 	}
@@ -136,7 +153,7 @@ func TestLocalNotify(t *testing.T) {
 	l.Register(vn, mockVN)
 
 	self := &Vnode{Id: []byte{60}}
-	res, err := l.Notify(vn, self)
+	res, err := l.Notify(context.Background(), vn, self)
 	if err != nil {
 		t.Fatalf("local notify failed")
 	}
@@ -148,7 +165,7 @@ func TestLocalNotify(t *testing.T) {
 	}
 
 	unknown := &Vnode{Id: []byte{1}}
-	res, err = l.Notify(unknown, self)
+	res, err = l.Notify(context.Background(), unknown, self)
 	if err == nil {
 		t.Fatalf("remote notify should fail")
 	}
@@ -163,7 +180,7 @@ func TestLocalFindSucc(t *testing.T) {
 	l.Register(vn, mockVN)
 
 	key := []byte("test")
-	res, err := l.FindSuccessors(vn, 1, key)
+	res, err := l.FindSuccessors(context.Background(), vn, 1, key)
 	if err != nil {
 		t.Fatalf("local FindSuccessor failed")
 	}
@@ -175,7 +192,7 @@ func TestLocalFindSucc(t *testing.T) {
 	}
 
 	unknown := &Vnode{Id: []byte{1}}
-	res, err = l.FindSuccessors(unknown, 1, key)
+	res, err = l.FindSuccessors(context.Background(), unknown, 1, key)
 	if err == nil {
 		t.Fatalf("remote find should fail")
 	}
@@ -188,7 +205,7 @@ func TestLocalClearPred(t *testing.T) {
 	vn := &Vnode{Id: []byte{12}}
 	l.Register(vn, mockVN)
 
-	err := l.ClearPredecessor(vn, pred)
+	err := l.ClearPredecessor(context.Background(), vn, pred)
 	if err != nil {
 		t.Fatalf("local ClearPredecessor failed")
 	}
@@ -197,7 +214,7 @@ func TestLocalClearPred(t *testing.T) {
 	}
 
 	unknown := &Vnode{Id: []byte{1}}
-	err = l.ClearPredecessor(unknown, pred)
+	err = l.ClearPredecessor(context.Background(), unknown, pred)
 	if err == nil {
 		t.Fatalf("remote clear should fail")
 	}
@@ -211,7 +228,7 @@ func TestLocalSkipSucc(t *testing.T) {
 	l.Register(vn, mockVN)
 
 	s := &Vnode{Id: []byte{40}}
-	err := l.SkipSuccessor(vn, s)
+	err := l.SkipSuccessor(context.Background(), vn, s)
 	if err != nil {
 		t.Fatalf("local Skip failed")
 	}
@@ -220,7 +237,7 @@ func TestLocalSkipSucc(t *testing.T) {
 	}
 
 	unknown := &Vnode{Id: []byte{1}}
-	err = l.SkipSuccessor(unknown, s)
+	err = l.SkipSuccessor(context.Background(), unknown, s)
 	if err == nil {
 		t.Fatalf("remote skip should fail")
 	}
@@ -231,18 +248,18 @@ func TestLocalDeregister(t *testing.T) {
 	vn := &Vnode{Id: []byte{1}}
 	mockVN := &MockVnodeRPC{}
 	l.Register(vn, mockVN)
-	if res, err := l.Ping(vn); !res || err != nil {
+	if res, err := l.Ping(context.Background(), vn); !res || err != nil {
 		t.Fatalf("local ping failed")
 	}
 	l.Deregister(vn)
-	if res, _ := l.Ping(vn); res {
+	if res, _ := l.Ping(context.Background(), vn); res {
 		t.Fatalf("local ping succeeded")
 	}
 }
 
 func TestBHList(t *testing.T) {
 	bh := BlackholeTransport{}
-	res, err := bh.ListVnodes("test")
+	res, err := bh.ListVnodes(context.Background(), "test")
 	if res != nil || err == nil {
 		t.Fatalf("expected fail")
 	}
@@ -251,7 +268,7 @@ func TestBHList(t *testing.T) {
 func TestBHPing(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
-	res, err := bh.Ping(vn)
+	res, err := bh.Ping(context.Background(), vn)
 	if res || err != nil {
 		t.Fatalf("expected fail")
 	}
@@ -260,7 +277,7 @@ func TestBHPing(t *testing.T) {
 func TestBHGetPred(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
-	_, err := bh.GetPredecessor(vn)
+	_, err := bh.GetPredecessor(context.Background(), vn)
 	if err.Error()[:18] != "Failed to connect!" {
 		t.Fatalf("expected fail")
 	}
@@ -270,7 +287,7 @@ func TestBHNotify(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
 	vn2 := &Vnode{Id: []byte{42}}
-	_, err := bh.Notify(vn, vn2)
+	_, err := bh.Notify(context.Background(), vn, vn2)
 	if err.Error()[:18] != "Failed to connect!" {
 		t.Fatalf("expected fail")
 	}
@@ -279,7 +296,7 @@ func TestBHNotify(t *testing.T) {
 func TestBHFindSuccessors(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
-	_, err := bh.FindSuccessors(vn, 1, []byte("test"))
+	_, err := bh.FindSuccessors(context.Background(), vn, 1, []byte("test"))
 	if err.Error()[:18] != "Failed to connect!" {
 		t.Fatalf("expected fail")
 	}
@@ -289,7 +306,7 @@ func TestBHClearPred(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
 	s := &Vnode{Id: []byte{50}}
-	err := bh.ClearPredecessor(vn, s)
+	err := bh.ClearPredecessor(context.Background(), vn, s)
 	if err.Error()[:18] != "Failed to connect!" {
 		t.Fatalf("expected fail")
 	}
@@ -299,8 +316,92 @@ func TestBHSkipSucc(t *testing.T) {
 	bh := BlackholeTransport{}
 	vn := &Vnode{Id: []byte{12}}
 	s := &Vnode{Id: []byte{50}}
-	err := bh.SkipSuccessor(vn, s)
+	err := bh.SkipSuccessor(context.Background(), vn, s)
 	if err.Error()[:18] != "Failed to connect!" {
 		t.Fatalf("expected fail")
 	}
 }
+
+// Loopback transport implementing the context-less interface
+type MockLegacyTransport struct {
+	vn    *Vnode
+	obj   LegacyVnodeRPC
+	block chan struct{}
+}
+
+func (ml *MockLegacyTransport) ListVnodes(host string) ([]*Vnode, error) {
+	return []*Vnode{ml.vn}, nil
+}
+func (ml *MockLegacyTransport) Ping(vn *Vnode) (bool, error) {
+	<-ml.block
+	return true, nil
+}
+func (ml *MockLegacyTransport) GetPredecessor(vn *Vnode) (*Vnode, error) {
+	return ml.obj.GetPredecessor()
+}
+func (ml *MockLegacyTransport) Notify(vn, self *Vnode) ([]*Vnode, error) {
+	return ml.obj.Notify(self)
+}
+func (ml *MockLegacyTransport) FindSuccessors(vn *Vnode, n int, key []byte) ([]*Vnode, error) {
+	return ml.obj.FindSuccessors(n, key)
+}
+func (ml *MockLegacyTransport) ClearPredecessor(target, self *Vnode) error {
+	return ml.obj.ClearPredecessor(self)
+}
+func (ml *MockLegacyTransport) SkipSuccessor(target, self *Vnode) error {
+	return ml.obj.SkipSuccessor(self)
+}
+func (ml *MockLegacyTransport) Register(v *Vnode, o LegacyVnodeRPC) {
+	ml.vn = v
+	ml.obj = o
+}
+
+func TestLegacyTransport(t *testing.T) {
+	ml := &MockLegacyTransport{block: make(chan struct{})}
+	trans := NewLegacyTransport(ml)
+
+	suc := []*Vnode{&Vnode{Id: []byte{40}}}
+	mockVN := &MockVnodeRPC{succ: suc}
+	vn := &Vnode{Id: []byte{12}}
+	trans.Register(vn, mockVN)
+
+	list, err := trans.ListVnodes(context.Background(), "test")
+	if err != nil || len(list) != 1 || list[0] != vn {
+		t.Fatalf("bad list: %v %v", list, err)
+	}
+
+	key := []byte("test")
+	res, err := trans.FindSuccessors(context.Background(), vn, 1, key)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if res[0] != suc[0] {
+		t.Fatalf("got wrong successor")
+	}
+	if bytes.Compare(mockVN.key, key) != 0 {
+		t.Fatalf("didn't get key correctly!")
+	}
+}
+
+func TestLegacyTransportContext(t *testing.T) {
+	ml := &MockLegacyTransport{block: make(chan struct{})}
+	defer close(ml.block)
+	trans := NewLegacyTransport(ml)
+
+	vn := &Vnode{Id: []byte{12}}
+	trans.Register(vn, &MockVnodeRPC{})
+
+	// A blocked call must return once the deadline passes
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := trans.Ping(ctx, vn); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline err. Got %v", err)
+	}
+
+	// A canceled context should never reach the transport
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := trans.FindSuccessors(ctx, vn, 1, []byte("test")); err != context.Canceled {
+		t.Fatalf("expected canceled err. Got %v", err)
+	}
+}
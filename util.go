@@ -67,8 +67,13 @@ func powerOffset(id []byte, exp int, mod int) []byte {
 	// Apply the mod
 	idInt.Mod(&sum, &ceil)
 
-	// Add together
-	return idInt.Bytes()
+	// Left pad to the length of the ID so comparisons stay valid
+	b := idInt.Bytes()
+	for i := range off {
+		off[i] = 0
+	}
+	copy(off[max(len(off)-len(b), 0):], b)
+	return off
 }
 
 // max returns the max of two ints
@@ -124,3 +129,43 @@ func trimSlice(vn []*Vnode) []*Vnode {
 	}
 	return vn[:idx+1]
 }
+
+// Returns the number of entries up to and including the last non-nil vnode
+func knownVnodes(vn []*Vnode) (known int) {
+	for i := 0; i < len(vn); i++ {
+		if vn[i] != nil {
+			known = i + 1
+		}
+	}
+	return
+}
+
+// Returns a copy of the vnode, or nil
+func copyVnode(vn *Vnode) *Vnode {
+	if vn == nil {
+		return nil
+	}
+	c := *vn
+	return &c
+}
+
+// Checks if two vnodes are the same, either may be nil
+func sameVnode(a, b *Vnode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Host == b.Host && bytes.Equal(a.Id, b.Id)
+}
+
+// Checks if two lists hold the same vnodes in the same order
+func sameVnodes(a, b []*Vnode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameVnode(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
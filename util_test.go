@@ -1,6 +1,7 @@
 package chord
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 	"time"
@@ -107,6 +108,13 @@ func TestPowerOffset(t *testing.T) {
 	if val[0] != 1 || val[1] != 0x7f || val[2] != 0xff || val[3] != 0xff {
 		t.Fatalf("unexpected val! %v", val)
 	}
+
+	// Wrapping around keeps the leading zeros
+	id = []byte{0xff, 0xff, 0xff, 0xff}
+	val = powerOffset(id, 0, mod)
+	if !bytes.Equal(val, []byte{0, 0, 0, 0}) {
+		t.Fatalf("unexpected val! %v", val)
+	}
 }
 
 func TestMax(t *testing.T) {
@@ -0,0 +1,215 @@
+package chord
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	context "golang.org/x/net/context"
+)
+
+// ViolationType identifies a broken ring invariant
+type ViolationType int
+
+const (
+	// ViolationPredecessor means the successor of Vnode, Other, does not
+	// have Vnode as its predecessor
+	ViolationPredecessor ViolationType = iota
+	// ViolationLoop means following the successors from Vnode led back to
+	// Other before every vnode of the ring was visited
+	ViolationLoop
+	// ViolationSkipped means Other lies between Vnode and its successor
+	ViolationSkipped
+	// ViolationOrder means the successor list of Vnode is not in ring order
+	// at Other
+	ViolationOrder
+	// ViolationUnreachable means Vnode, or the host of Other, could not be
+	// queried
+	ViolationUnreachable
+)
+
+func (t ViolationType) String() string {
+	switch t {
+	case ViolationPredecessor:
+		return "predecessor"
+	case ViolationLoop:
+		return "loop"
+	case ViolationSkipped:
+		return "skipped"
+	case ViolationOrder:
+		return "order"
+	case ViolationUnreachable:
+		return "unreachable"
+	}
+	return fmt.Sprintf("ViolationType(%d)", int(t))
+}
+
+// Violation is a broken ring invariant found by Verify
+type Violation struct {
+	Type  ViolationType
+	Vnode *Vnode // Vnode the violation was found at
+	Other *Vnode // Other vnode involved, if any
+	Err   error  // Why an unreachable vnode could not be queried
+}
+
+func (v Violation) String() string {
+	switch {
+	case v.Err != nil:
+		return fmt.Sprintf("%s at %s: %s", v.Type, v.Vnode, v.Err)
+	case v.Other != nil:
+		return fmt.Sprintf("%s at %s: %s", v.Type, v.Vnode, v.Other)
+	}
+	return fmt.Sprintf("%s at %s", v.Type, v.Vnode)
+}
+
+// VerifyReport is the result of walking the ring with Verify
+type VerifyReport struct {
+	Start      *Vnode      // Local vnode the walk started from
+	Walked     []*Vnode    // Vnodes visited following the successors, in order
+	Listed     int         // Vnodes listed by the hosts walked through
+	Closed     bool        // Whether the walk made it back to Start
+	Violations []Violation // Broken invariants found
+}
+
+// OK returns whether the walk covered the whole ring without violations
+func (r *VerifyReport) OK() bool {
+	return r.Closed && len(r.Violations) == 0
+}
+
+// Verify walks the whole ring from a local vnode, following the immediate
+// successors over the transport, and checks the ring invariants:
+//
+//   - the predecessor of every successor points back
+//   - the walk only comes back to its start, after every vnode
+//   - no vnode listed by the hosts walked through is skipped
+//   - the successor lists are in ring order
+//
+// The walk stops at the first vnode that cannot be queried.  An error is only
+// returned if the walk could not start or the context ended.
+func (r *Ring) Verify(ctx context.Context) (*VerifyReport, error) {
+	vnodes := r.localVnodes()
+	if len(vnodes) == 0 {
+		return nil, fmt.Errorf("ring has no local vnodes")
+	}
+	start := &vnodes[0].Vnode
+	report := &VerifyReport{Start: start}
+	trans := r.transport
+	hb := r.config.hashBits
+
+	var (
+		visited = make(map[string]bool)
+		hosts   = make(map[string]bool)
+		listed  = make(map[string]*Vnode)
+		edges   [][2]*Vnode
+	)
+	violate := func(t ViolationType, vn, other *Vnode, err error) {
+		report.Violations = append(report.Violations, Violation{Type: t, Vnode: vn, Other: other, Err: err})
+	}
+
+	cur := start
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		visited[cur.StringID()] = true
+		report.Walked = append(report.Walked, cur)
+
+		// List the vnodes of every host we come across
+		if !hosts[cur.Host] {
+			hosts[cur.Host] = true
+			list, err := trans.ListVnodes(ctx, cur.Host)
+			if err != nil {
+				violate(ViolationUnreachable, cur, cur, err)
+			}
+			for _, vn := range list {
+				listed[vn.StringID()] = vn
+			}
+		}
+
+		// The successors of the key just past a vnode are its successor list
+		succs, err := trans.FindSuccessors(ctx, cur, r.config.NumSuccessors, powerOffset(cur.Id, 0, hb))
+		if err != nil {
+			violate(ViolationUnreachable, cur, nil, err)
+			break
+		}
+		var known []*Vnode
+		for _, s := range succs {
+			if s != nil {
+				known = append(known, s)
+			}
+		}
+		if len(known) == 0 {
+			violate(ViolationUnreachable, cur, nil, errNoSuccessor)
+			break
+		}
+		if bad := unordered(cur, known, hb); bad != nil {
+			violate(ViolationOrder, cur, bad, nil)
+		}
+
+		// The successor must point back at us
+		next := known[0]
+		pred, err := trans.GetPredecessor(ctx, next)
+		if err != nil {
+			violate(ViolationUnreachable, next, nil, err)
+			break
+		}
+		if pred == nil || pred.StringID() != cur.StringID() {
+			violate(ViolationPredecessor, cur, next, nil)
+		}
+		edges = append(edges, [2]*Vnode{cur, next})
+
+		// Done once back to the start
+		if next.StringID() == start.StringID() {
+			report.Closed = true
+			break
+		}
+		if visited[next.StringID()] {
+			violate(ViolationLoop, cur, next, nil)
+			break
+		}
+		cur = next
+	}
+
+	// Every listed vnode must have been walked through
+	report.Listed = len(listed)
+	all := sortedVnodes(listed)
+	for _, e := range edges {
+		for _, vn := range all {
+			if between(e[0].Id, e[1].Id, vn.Id) {
+				violate(ViolationSkipped, e[0], vn, nil)
+			}
+		}
+	}
+	if report.Closed && len(report.Walked) < len(listed) {
+		violate(ViolationLoop, report.Walked[len(report.Walked)-1], start, nil)
+	}
+	return report, nil
+}
+
+// Returns the first successor out of ring order past the vnode, nil if they
+// are in order.  Lists longer than the ring wrap back to the vnode and repeat.
+func unordered(vn *Vnode, succs []*Vnode, bits int) *Vnode {
+	var last *Vnode
+	for _, s := range succs {
+		if bytes.Equal(s.Id, vn.Id) {
+			break
+		}
+		if last != nil && distance(vn.Id, s.Id, bits).Cmp(distance(vn.Id, last.Id, bits)) <= 0 {
+			return s
+		}
+		last = s
+	}
+	return nil
+}
+
+// Returns the vnodes sorted by ID
+func sortedVnodes(vnodes map[string]*Vnode) []*Vnode {
+	out := make([]*Vnode, 0, len(vnodes))
+	for _, vn := range vnodes {
+		out = append(out, vn)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].Id, out[j].Id) < 0
+	})
+	return out
+}
@@ -0,0 +1,133 @@
+package chord
+
+import (
+	"sort"
+	"testing"
+
+	context "golang.org/x/net/context"
+)
+
+// Returns a ring of local vnodes with consistent routing state and no
+// stabilization running
+func makeVerifyRing() *Ring {
+	r := makeRing()
+	sort.Sort(r)
+	r.setLocalSuccessors()
+	num := len(r.vnodes)
+	for i, vn := range r.vnodes {
+		vn.predecessor = &r.vnodes[(i+num-1)%num].Vnode
+	}
+	return r
+}
+
+func hasViolation(report *VerifyReport, t ViolationType) bool {
+	for _, v := range report.Violations {
+		if v.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerify(t *testing.T) {
+	r := makeVerifyRing()
+	report, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if !report.OK() || len(report.Walked) != len(r.vnodes) || report.Listed != len(r.vnodes) {
+		t.Fatalf("bad report %+v", report)
+	}
+}
+
+func TestVerifySkipped(t *testing.T) {
+	r := makeVerifyRing()
+
+	// vn0 skips vn1, which still points back at vn0
+	vn0 := r.vnodes[0]
+	copy(vn0.successors, vn0.successors[1:])
+	report, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if report.OK() || !report.Closed {
+		t.Fatalf("bad report %+v", report)
+	}
+	if !hasViolation(report, ViolationSkipped) || !hasViolation(report, ViolationPredecessor) || !hasViolation(report, ViolationLoop) {
+		t.Fatalf("missing violations %v", report.Violations)
+	}
+}
+
+func TestVerifyLoop(t *testing.T) {
+	r := makeVerifyRing()
+
+	// vn2 points back at vn1
+	r.vnodes[2].successors[0] = &r.vnodes[1].Vnode
+	report, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if report.Closed || len(report.Walked) != 3 || !hasViolation(report, ViolationLoop) {
+		t.Fatalf("bad report %+v", report)
+	}
+}
+
+func TestVerifyOrder(t *testing.T) {
+	r := makeVerifyRing()
+
+	vn := r.vnodes[0]
+	vn.successors[1], vn.successors[2] = vn.successors[2], vn.successors[1]
+	report, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if len(report.Violations) != 1 || report.Violations[0].Type != ViolationOrder || report.Violations[0].Other != vn.successors[2] {
+		t.Fatalf("bad report %v", report.Violations)
+	}
+}
+
+func TestVerifyUnreachable(t *testing.T) {
+	r := makeVerifyRing()
+
+	// vn1 is gone
+	(r.transport.(*LocalTransport)).Deregister(&r.vnodes[1].Vnode)
+	report, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if report.Closed || !hasViolation(report, ViolationUnreachable) {
+		t.Fatalf("bad report %+v", report)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Verify(ctx); err != context.Canceled {
+		t.Fatalf("expected canceled err. Got %v", err)
+	}
+}
+
+func TestVerifyJoined(t *testing.T) {
+	ml := InitMLTransport()
+	r, err := Create(fastConf(), ml)
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	defer r.Shutdown()
+
+	conf2 := fastConf()
+	conf2.Hostname = "test2"
+	r2, err := Join(conf2, ml, "test")
+	if err != nil {
+		t.Fatalf("failed to join local node! Got %s", err)
+	}
+	defer r2.Shutdown()
+	waitStable(t, r, r2)
+
+	report, err := r2.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err. %s", err)
+	}
+	if !report.OK() || len(report.Walked) != 16 || report.Listed != 16 {
+		t.Fatalf("bad report %+v %v", report, report.Violations)
+	}
+}
@@ -1,12 +1,19 @@
 package chord
 
 import (
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
+
+	context "golang.org/x/net/context"
+)
+
+var (
+	errNoSuccessor       = errors.New("Node has no successor!")
+	errAllSuccessorsDead = errors.New("All known successors dead!")
 )
 
 // MarshalJSON is a custom JSON marshaller
@@ -24,9 +31,12 @@ func (vn *Vnode) StringID() string {
 }
 
 // Initializes a local vnode
-func (vn *localVnode) init(idx int) {
+func (vn *localVnode) init(idx int) error {
 	// Generate an ID
-	vn.genId(uint16(idx))
+	vn.index = idx
+	if err := vn.genId(idx); err != nil {
+		return err
+	}
 	// Set our host
 	vn.Host = vn.ring.config.Hostname
 	// Try to set binary metadata
@@ -38,42 +48,91 @@ func (vn *localVnode) init(idx int) {
 
 	// Register with the RPC mechanism
 	vn.ring.transport.Register(&vn.Vnode, vn)
+	return nil
 }
 
 // Schedules the Vnode to do regular maintenence
 func (vn *localVnode) schedule() {
+	vn.lock.Lock()
+	defer vn.lock.Unlock()
+
+	// Don't reschedule a stopped vnode
+	if vn.stopCh != nil {
+		vn.stopCh <- true
+		return
+	}
+
 	// Setup our stabilize timer
-	vn.timer = time.AfterFunc(randStabilize(vn.ring.config), vn.stabilize)
+	vn.timer = time.AfterFunc(vn.nextStabilize(), vn.stabilize)
+}
+
+// Stops the regular maintenance of a vnode that has been scheduled, waiting
+// for a running stabilization to complete
+func (vn *localVnode) stop() {
+	stopCh := make(chan bool, 1)
+	vn.lock.Lock()
+	vn.stopCh = stopCh
+	timer := vn.timer
+	vn.lock.Unlock()
+
+	// Done if the timer had not fired yet
+	if timer != nil && timer.Stop() {
+		return
+	}
+	<-stopCh
 }
 
 // Generates an ID for the node
-func (vn *localVnode) genId(idx uint16) {
-	// Use the hash funciton
+func (vn *localVnode) genId(idx int) error {
+	// Use the configured generator, hashing the hostname by default
 	conf := vn.ring.config
-	hash := conf.HashFunc()
-	hash.Write([]byte(conf.Hostname))
-	binary.Write(hash, binary.BigEndian, idx)
-
-	// Use the hash as the ID
-	vn.Id = hash.Sum(nil)
+	gen := conf.IDGenerator
+	if gen == nil {
+		gen = HostnameIDGenerator{}
+	}
+	id, err := gen.GenerateID(conf, idx)
+	if err != nil {
+		return err
+	}
+	if size := conf.HashFunc().Size(); len(id) != size {
+		return fmt.Errorf("generated ID is %d bytes, expected %d", len(id), size)
+	}
+	vn.Id = id
+	return nil
 }
 
 // Called to periodically stabilize the vnode
 func (vn *localVnode) stabilize() {
 	// Clear the timer
+	vn.lock.Lock()
 	vn.timer = nil
+	stopCh := vn.stopCh
+	vn.lock.Unlock()
+
+	// Check for the vnode being stopped
+	if stopCh != nil {
+		stopCh <- true
+		return
+	}
 
 	// Check for shutdown
-	if vn.ring.shutdown != nil {
-		vn.ring.shutdown <- true
+	if shutdown := vn.ring.shutdownCh(); shutdown != nil {
+		shutdown <- true
 		return
 	}
 
 	// Setup the next stabilize timer
 	defer vn.schedule()
+	succs := vn.successorList(true)
 
 	// Check for new successor
-	if err := vn.checkNewSuccessor(); err != nil {
+	if err := vn.checkNewSuccessor(); err == errNoSuccessor || err == errAllSuccessorsDead {
+		// We are cut off from the ring, try to find our way back
+		if err = vn.recover(); err != nil {
+			log.Printf("[ERR] Failed to recover isolated vnode %s: %s", vn.StringID(), err)
+			return
+		}
+	} else if err != nil {
 		log.Printf("[ERR] Error checking for new successor: %s", err)
 	}
 
@@ -92,51 +151,89 @@ func (vn *localVnode) stabilize() {
 		log.Printf("[ERR] Error checking predecessor: %s", err)
 	}
 
+	// Inform the subscribers of the changed successors
+	vn.publishSuccessors(succs)
+
 	// Set the last stabilized time
+	vn.lock.Lock()
 	vn.stabilized = time.Now()
+	vn.countRound()
+	vn.lock.Unlock()
+	vn.ring.publish(Event{Type: EventStabilized, Local: &vn.Vnode})
+}
+
+// Informs the subscribers if the successors changed from the given list
+func (vn *localVnode) publishSuccessors(prev []*Vnode) {
+	succs := vn.successorList(true)
+	var oldSucc, newSucc *Vnode
+	if len(prev) > 0 {
+		oldSucc = prev[0]
+	}
+	if len(succs) > 0 {
+		newSucc = succs[0]
+	}
+	if newSucc != nil && !sameVnode(oldSucc, newSucc) {
+		vn.ring.publish(Event{Type: EventNewSuccessor, Local: &vn.Vnode, Remote: newSucc, Prev: oldSucc})
+	}
+	if !sameVnodes(prev, succs) {
+		vn.noteChange(changeSuccessors)
+		vn.ring.publish(Event{Type: EventSuccessorsChanged, Local: &vn.Vnode, Successors: succs, PrevSuccessors: prev})
+	}
 }
 
 // Checks for a new successor
 func (vn *localVnode) checkNewSuccessor() error {
 	// Ask our successor for it's predecessor
 	trans := vn.ring.transport
+	ctx := context.Background()
 
 CHECK_NEW_SUC:
-	succ := vn.successors[0]
+	succ := vn.successor()
 	if succ == nil {
-		panic("Node has no successor!")
+		return errNoSuccessor
 	}
-	maybe_suc, err := trans.GetPredecessor(succ)
+	maybe_suc, err := trans.GetPredecessor(ctx, succ)
 	if err != nil {
 		// Check if we have succ list, try to contact next live succ
-		known := vn.knownSuccessors()
-		if known > 1 {
-			for i := 0; i < known; i++ {
-				if alive, _ := trans.Ping(vn.successors[0]); !alive {
-					// Don't eliminate the last successor we know of
-					if i+1 == known {
-						return fmt.Errorf("All known successors dead!")
-					}
-
-					// Advance the successors list past the dead one
-					copy(vn.successors[0:], vn.successors[1:])
-					vn.successors[known-1-i] = nil
-				} else {
+		if vn.knownSuccessors() > 1 {
+			for {
+				// The list may have been emptied since we last looked
+				succ = vn.successor()
+				if succ == nil {
+					return errNoSuccessor
+				}
+				if alive, _ := trans.Ping(ctx, succ); alive {
 					// Found live successor, check for new one
+					vn.ring.heartbeat(succ.Host)
 					goto CHECK_NEW_SUC
 				}
+
+				// Keep the successor until it is suspected enough
+				if !vn.ring.suspect(succ.Host) {
+					return err
+				}
+
+				// Advance the successors list past the dead one.  Don't
+				// eliminate the last successor we know of
+				if !vn.dropSuccessor(succ) {
+					return errAllSuccessorsDead
+				}
 			}
 		}
 		return err
 	}
+	vn.ring.heartbeat(succ.Host)
 
 	// Check if we should replace our successor
 	if maybe_suc != nil && between(vn.Id, succ.Id, maybe_suc.Id) {
 		// Check if new successor is alive before switching
-		alive, err := trans.Ping(maybe_suc)
+		alive, err := trans.Ping(ctx, maybe_suc)
 		if alive && err == nil {
+			vn.ring.heartbeat(maybe_suc.Host)
+			vn.lock.Lock()
 			copy(vn.successors[1:], vn.successors[0:len(vn.successors)-1])
 			vn.successors[0] = maybe_suc
+			vn.lock.Unlock()
 		} else {
 			return err
 		}
@@ -144,16 +241,41 @@ CHECK_NEW_SUC:
 	return nil
 }
 
+// Removes a dead successor from the head of the successor list.  Returns
+// false if it is the only successor known, in which case it is kept.
+func (vn *localVnode) dropSuccessor(dead *Vnode) bool {
+	vn.lock.Lock()
+	defer vn.lock.Unlock()
+
+	// The list changed underneath us, let the caller retry
+	if vn.successors[0] == nil || vn.successors[0].StringID() != dead.StringID() {
+		return true
+	}
+
+	known := knownVnodes(vn.successors)
+	if known <= 1 {
+		return false
+	}
+	copy(vn.successors[0:], vn.successors[1:])
+	vn.successors[known-1] = nil
+	return true
+}
+
 // RPC: Invoked to return out predecessor
-func (vn *localVnode) GetPredecessor() (*Vnode, error) {
+func (vn *localVnode) GetPredecessor(ctx context.Context) (*Vnode, error) {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
 	return vn.predecessor, nil
 }
 
 // Notifies our successor of us, updates successor list
 func (vn *localVnode) notifySuccessor() error {
 	// Notify successor
-	succ := vn.successors[0]
-	succ_list, err := vn.ring.transport.Notify(succ, &vn.Vnode)
+	succ := vn.successor()
+	if succ == nil {
+		return errNoSuccessor
+	}
+	succ_list, err := vn.ring.transport.Notify(context.Background(), succ, &vn.Vnode)
 	if err != nil {
 		return err
 	}
@@ -165,6 +287,13 @@ func (vn *localVnode) notifySuccessor() error {
 	}
 
 	// Update local successors list
+	vn.lock.Lock()
+	defer vn.lock.Unlock()
+
+	// Our successor was replaced while we were waiting on it
+	if vn.successors[0] != succ {
+		return nil
+	}
 	for idx, s := range succ_list {
 		if s == nil {
 			break
@@ -179,91 +308,154 @@ func (vn *localVnode) notifySuccessor() error {
 }
 
 // RPC: Notify is invoked when a Vnode gets notified
-func (vn *localVnode) Notify(maybe_pred *Vnode) ([]*Vnode, error) {
+func (vn *localVnode) Notify(ctx context.Context, maybe_pred *Vnode) ([]*Vnode, error) {
+	vn.lock.Lock()
+
 	// Check if we should update our predecessor
+	var (
+		changed      bool
+		old          = vn.predecessor
+		gained, lost *KeyRange
+		prev         *Vnode
+	)
 	if vn.predecessor == nil || between(vn.predecessor.Id, vn.Id, maybe_pred.Id) {
-		// Inform the delegate
-		conf := vn.ring.config
-		old := vn.predecessor
-		vn.ring.invokeDelegate(func() {
-			conf.Delegate.NewPredecessor(&vn.Vnode, maybe_pred, old)
-		})
-
 		vn.predecessor = maybe_pred
+		changed = true
+		gained, lost, prev = vn.updateOwned(maybe_pred)
 	}
 
-	// Return our successors list
-	return vn.successors, nil
+	// Return a copy of our successors list
+	succs := make([]*Vnode, len(vn.successors))
+	copy(succs, vn.successors)
+	vn.lock.Unlock()
+
+	// Inform the subscribers
+	if changed {
+		vn.noteChange(changePredecessor)
+		vn.ring.publish(Event{Type: EventNewPredecessor, Local: &vn.Vnode, Remote: maybe_pred, Prev: old})
+		vn.publishOwnership(gained, lost, prev)
+	}
+
+	return succs, nil
 }
 
 // Fixes up the finger table
 func (vn *localVnode) fixFingerTable() error {
 	// Determine the offset
 	hb := vn.ring.config.hashBits
-	offset := powerOffset(vn.Id, vn.lastFinger, hb)
-
-	// Find the successor
-	nodes, err := vn.FindSuccessors(1, offset)
+	vn.lock.RLock()
+	lastFinger := vn.lastFinger
+	vn.lock.RUnlock()
+	offset := powerOffset(vn.Id, lastFinger, hb)
+
+	// Find the successor, and the ones after it to pick a nearby node
+	n := 1
+	if vn.ring.config.ProximityRouting {
+		n = vn.ring.config.NumSuccessors
+	}
+	nodes, err := vn.FindSuccessors(context.Background(), n, offset)
 	if nodes == nil || len(nodes) == 0 || err != nil {
 		return err
 	}
 	node := nodes[0]
 
-	// Update the finger table
-	vn.finger[vn.lastFinger] = node
-
-	// Try to skip as many finger entries as possible
-	for {
-		next := vn.lastFinger + 1
-		if next >= hb {
+	// Try to skip as many finger entries as possible, while the node is
+	// their successor
+	first := lastFinger
+	for next := lastFinger + 1; next < hb; next++ {
+		if !betweenRightIncl(vn.Id, node.Id, powerOffset(vn.Id, next, hb)) {
 			break
 		}
-		offset := powerOffset(vn.Id, next, hb)
+		lastFinger = next
+	}
 
-		// While the node is the successor, update the finger entries
-		if betweenRightIncl(vn.Id, node.Id, offset) {
-			vn.finger[next] = node
-			vn.lastFinger = next
-		} else {
-			break
+	// Any node before the next entry routes as well, prefer the nearest
+	if len(nodes) > 1 {
+		limit := vn.Id
+		if lastFinger+1 < hb {
+			limit = powerOffset(vn.Id, lastFinger+1, hb)
 		}
+		node = vn.ring.nearest(vn.candidatesBefore(nodes, limit))
+	}
+
+	// Update the finger table
+	vn.lock.Lock()
+	prev := vn.finger[first]
+	changed := false
+	for i := first; i <= lastFinger; i++ {
+		changed = changed || !sameVnode(vn.finger[i], node)
+		vn.finger[i] = node
 	}
 
 	// Increment to the index to repair
-	if vn.lastFinger+1 == hb {
+	if lastFinger+1 == hb {
 		vn.lastFinger = 0
 	} else {
-		vn.lastFinger++
+		vn.lastFinger = lastFinger + 1
 	}
+	vn.lock.Unlock()
 
+	// Inform the subscribers
+	if changed {
+		vn.noteChange(changeFingers)
+		fr := &FingerRange{Start: first, End: lastFinger, Vnode: node}
+		vn.ring.publish(Event{Type: EventFingerChanged, Local: &vn.Vnode, Remote: node, Prev: prev, Finger: fr})
+	}
 	return nil
 }
 
 // Checks the health of our predecessor
 func (vn *localVnode) checkPredecessor() error {
 	// Check predecessor
-	if vn.predecessor != nil {
-		res, err := vn.ring.transport.Ping(vn.predecessor)
-		if err != nil {
+	vn.lock.RLock()
+	pred := vn.predecessor
+	vn.lock.RUnlock()
+	if pred != nil {
+		res, err := vn.ring.transport.Ping(context.Background(), pred)
+		if res && err == nil {
+			vn.ring.heartbeat(pred.Host)
+			return nil
+		}
+
+		// Without a failure detector errors leave the predecessor alone
+		if err != nil && vn.ring.config.PhiThreshold <= 0 {
 			return err
 		}
 
-		// Predecessor is dead
-		if !res {
-			vn.predecessor = nil
+		// Predecessor is dead once suspected enough, unless it was replaced
+		// in the meantime
+		if vn.ring.suspect(pred.Host) {
+			vn.lock.Lock()
+			cleared := vn.predecessor == pred
+			if cleared {
+				vn.predecessor = nil
+			}
+			vn.lock.Unlock()
+			if cleared {
+				vn.noteChange(changePredecessor)
+			}
 		}
+		return err
 	}
 	return nil
 }
 
 // Finds next N successors. N must be <= NumSuccessors
-func (vn *localVnode) FindSuccessors(n int, key []byte) ([]*Vnode, error) {
+func (vn *localVnode) FindSuccessors(ctx context.Context, n int, key []byte) ([]*Vnode, error) {
+	// Work off a snapshot of the routing state
+	succs := vn.successorList(false)
+	if succs[0] == nil {
+		return nil, errNoSuccessor
+	}
+
 	// Check if we are the immediate predecessor
-	if betweenRightIncl(vn.Id, vn.successors[0].Id, key) {
-		return vn.successors[:n], nil
+	if betweenRightIncl(vn.Id, succs[0].Id, key) {
+		return succs[:n], nil
 	}
 
 	// Try the closest preceeding nodes
+	trace := traceFrom(ctx)
+	fallback := false
 	cp := closestPreceedingVnodeIterator{}
 	cp.init(vn, key)
 	for {
@@ -274,23 +466,32 @@ func (vn *localVnode) FindSuccessors(n int, key []byte) ([]*Vnode, error) {
 		}
 
 		// Try that node, break on success
-		res, err := vn.ring.transport.FindSuccessors(closest, n, key)
+		hop := trace.begin(closest, fallback)
+		start := time.Now()
+		res, err := vn.ring.transport.FindSuccessors(ctx, closest, n, key)
+		trace.end(hop, start, err)
 		if err == nil {
 			return res, nil
 		}
+		// Give up if the caller is no longer waiting
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		log.Printf("[ERR] Failed to contact %s. Got %s", closest.StringID(), err)
+		fallback = true
 	}
 
 	// Determine how many successors we know of
-	successors := vn.knownSuccessors()
+	successors := knownVnodes(succs)
 
 	// Check if the ID is between us and any non-immediate successors
 	for i := 1; i <= successors-n; i++ {
-		if betweenRightIncl(vn.Id, vn.successors[i].Id, key) {
-			remain := vn.successors[i:]
+		if betweenRightIncl(vn.Id, succs[i].Id, key) {
+			remain := succs[i:]
 			if len(remain) > n {
 				remain = remain[:n]
 			}
+			trace.end(trace.begin(&vn.Vnode, true), time.Now(), nil)
 			return remain, nil
 		}
 	}
@@ -301,64 +502,145 @@ func (vn *localVnode) FindSuccessors(n int, key []byte) ([]*Vnode, error) {
 
 // Instructs the vnode to leave
 func (vn *localVnode) leave() error {
-	// Inform the delegate we are leaving
-	conf := vn.ring.config
+	vn.lock.RLock()
 	pred := vn.predecessor
 	succ := vn.successors[0]
-	vn.ring.invokeDelegate(func() {
-		conf.Delegate.Leaving(&vn.Vnode, pred, succ)
-	})
+	vn.lock.RUnlock()
+
+	// Inform the subscribers we are leaving
+	vn.ring.publish(Event{Type: EventLeaving, Local: &vn.Vnode, Remote: succ, Prev: pred})
 
 	// Notify predecessor to advance to their next successor
 	var err error
+	ctx := context.Background()
 	trans := vn.ring.transport
-	if vn.predecessor != nil {
-		err = trans.SkipSuccessor(vn.predecessor, &vn.Vnode)
+	if pred != nil {
+		err = trans.SkipSuccessor(ctx, pred, &vn.Vnode)
 	}
 
 	// Notify successor to clear old predecessor
-	err = mergeErrors(err, trans.ClearPredecessor(vn.successors[0], &vn.Vnode))
+	if succ != nil {
+		err = mergeErrors(err, trans.ClearPredecessor(ctx, succ, &vn.Vnode))
+	}
 	return err
 }
 
 // Used to clear our predecessor when a node is leaving
-func (vn *localVnode) ClearPredecessor(p *Vnode) error {
-	if vn.predecessor != nil && vn.predecessor.StringID() == p.StringID() {
-		// Inform the delegate
-		conf := vn.ring.config
-		old := vn.predecessor
-		vn.ring.invokeDelegate(func() {
-			conf.Delegate.PredecessorLeaving(&vn.Vnode, old)
-		})
-		vn.predecessor = nil
+func (vn *localVnode) ClearPredecessor(ctx context.Context, p *Vnode) error {
+	vn.lock.Lock()
+	old := vn.predecessor
+	if old == nil || old.StringID() != p.StringID() {
+		vn.lock.Unlock()
+		return nil
 	}
+	vn.predecessor = nil
+	vn.lock.Unlock()
+
+	// Inform the subscribers
+	vn.noteChange(changePredecessor)
+	vn.ring.publish(Event{Type: EventPredecessorLeaving, Local: &vn.Vnode, Remote: old})
 	return nil
 }
 
 // Used to skip a successor when a node is leaving
-func (vn *localVnode) SkipSuccessor(s *Vnode) error {
+func (vn *localVnode) SkipSuccessor(ctx context.Context, s *Vnode) error {
+	vn.lock.Lock()
+	old := vn.successors[0]
 	// Skip if we have a match
-	if vn.successors[0].StringID() == s.StringID() {
-		// Inform the delegate
-		conf := vn.ring.config
-		old := vn.successors[0]
-		vn.ring.invokeDelegate(func() {
-			conf.Delegate.SuccessorLeaving(&vn.Vnode, old)
-		})
-
-		known := vn.knownSuccessors()
-		copy(vn.successors[0:], vn.successors[1:])
-		vn.successors[known-1] = nil
+	if old == nil || old.StringID() != s.StringID() {
+		vn.lock.Unlock()
+		return nil
 	}
+	known := knownVnodes(vn.successors)
+	prev := make([]*Vnode, known)
+	copy(prev, vn.successors)
+	copy(vn.successors[0:], vn.successors[1:])
+	vn.successors[known-1] = nil
+	vn.lock.Unlock()
+
+	// Inform the subscribers
+	vn.ring.publish(Event{Type: EventSuccessorLeaving, Local: &vn.Vnode, Remote: old})
+	vn.publishSuccessors(prev)
 	return nil
 }
 
-// Determine how many successors we know of
-func (vn *localVnode) knownSuccessors() (successors int) {
-	for i := 0; i < len(vn.successors); i++ {
-		if vn.successors[i] != nil {
-			successors = i + 1
+// Replaces the successor list, used when joining a ring
+func (vn *localVnode) setSuccessors(succs []*Vnode) {
+	vn.lock.Lock()
+	defer vn.lock.Unlock()
+	for idx := range vn.successors {
+		if idx < len(succs) {
+			vn.successors[idx] = succs[idx]
+		} else {
+			vn.successors[idx] = nil
 		}
 	}
-	return
+}
+
+// Returns our immediate successor
+func (vn *localVnode) successor() *Vnode {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
+	if len(vn.successors) == 0 {
+		return nil
+	}
+	return vn.successors[0]
+}
+
+// Returns a consistent copy of the successor list.  If trim is set the
+// trailing unknown successors are removed.
+func (vn *localVnode) successorList(trim bool) []*Vnode {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
+
+	succs := make([]*Vnode, len(vn.successors))
+	copy(succs, vn.successors)
+	if trim {
+		return succs[:knownVnodes(succs)]
+	}
+	return succs
+}
+
+// Returns a snapshot of the vnode's routing state
+func (vn *localVnode) info() *VnodeInfo {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
+
+	info := &VnodeInfo{
+		Vnode:       vn.Vnode,
+		Predecessor: copyVnode(vn.predecessor),
+		Successors:  make([]*Vnode, 0, len(vn.successors)),
+		LastFinger:  vn.lastFinger,
+		Stabilized:  vn.stabilized,
+		Stabilize:   vn.stats,
+	}
+	for _, s := range vn.successors {
+		if s == nil {
+			break
+		}
+		info.Successors = append(info.Successors, copyVnode(s))
+	}
+
+	// Collapse runs of identical fingers
+	var last *FingerRange
+	for i, f := range vn.finger {
+		if f == nil {
+			last = nil
+			continue
+		}
+		if last != nil && last.Vnode.StringID() == f.StringID() {
+			last.End = i
+			continue
+		}
+		info.Fingers = append(info.Fingers, FingerRange{Start: i, End: i, Vnode: copyVnode(f)})
+		last = &info.Fingers[len(info.Fingers)-1]
+	}
+	return info
+}
+
+// Determine how many successors we know of
+func (vn *localVnode) knownSuccessors() int {
+	vn.lock.RLock()
+	defer vn.lock.RUnlock()
+	return knownVnodes(vn.successors)
 }
@@ -3,9 +3,13 @@ package chord
 import (
 	"bytes"
 	"crypto/sha1"
+	"fmt"
 	"sort"
+	"sync"
 	"testing"
 	"time"
+
+	context "golang.org/x/net/context"
 )
 
 func makeVnode() *localVnode {
@@ -50,7 +54,7 @@ func TestGenId(t *testing.T) {
 	vn := makeVnode()
 	var ids [][]byte
 	for i := 0; i < 16; i++ {
-		vn.genId(uint16(i))
+		vn.genId(i)
 		ids = append(ids, vn.Id)
 	}
 
@@ -111,16 +115,13 @@ func TestVnodeKnownSucc(t *testing.T) {
 	}
 }
 
-// Checks panic if no successors
-func TestVnodeCheckNewSuccAlivePanic(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Fatalf("expected panic!")
-		}
-	}()
+// Checks the error if no successors
+func TestVnodeCheckNewSuccNoSucc(t *testing.T) {
 	vn1 := makeVnode()
 	vn1.init(1)
-	vn1.checkNewSuccessor()
+	if err := vn1.checkNewSuccessor(); err != errNoSuccessor {
+		t.Fatalf("unexpected err %v", err)
+	}
 }
 
 // Checks pinging a live successor with no changes
@@ -134,7 +135,7 @@ func TestVnodeCheckNewSuccAlive(t *testing.T) {
 	vn2.predecessor = &vn1.Vnode
 	vn1.successors[0] = &vn2.Vnode
 
-	if pred, _ := vn2.GetPredecessor(); pred != &vn1.Vnode {
+	if pred, _ := vn2.GetPredecessor(context.Background()); pred != &vn1.Vnode {
 		t.Fatalf("expected vn1 as predecessor")
 	}
 
@@ -233,7 +234,7 @@ func TestVnodeCheckNewSuccNewSucc(t *testing.T) {
 	vn3.predecessor = &vn2.Vnode
 
 	// vn3 pred is vn2
-	if pred, _ := vn3.GetPredecessor(); pred != &vn2.Vnode {
+	if pred, _ := vn3.GetPredecessor(context.Background()); pred != &vn2.Vnode {
 		t.Fatalf("expected vn2 as predecessor")
 	}
 
@@ -281,6 +282,35 @@ func TestVnodeCheckNewSuccNewSuccDead(t *testing.T) {
 	}
 }
 
+// Drops the successor of a vnode while it asks for its predecessor, as a
+// concurrent SkipSuccessor would
+type droppingTrans struct {
+	*LocalTransport
+	vn *localVnode
+}
+
+func (d *droppingTrans) GetPredecessor(ctx context.Context, vn *Vnode) (*Vnode, error) {
+	d.vn.lock.Lock()
+	d.vn.successors[0] = nil
+	d.vn.lock.Unlock()
+	return nil, fmt.Errorf("successor is gone")
+}
+
+// Checks the successor being dropped while retrying
+func TestVnodeCheckNewSuccDropped(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+
+	vn1 := r.vnodes[0]
+	vn1.successors[0] = &r.vnodes[1].Vnode
+	vn1.successors[1] = &r.vnodes[2].Vnode
+	r.transport = &droppingTrans{LocalTransport: r.transport.(*LocalTransport), vn: vn1}
+
+	if err := vn1.checkNewSuccessor(); err != errNoSuccessor {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
+
 // Test notifying a successor successfully
 func TestVnodeNotifySucc(t *testing.T) {
 	r := makeRing()
@@ -339,6 +369,21 @@ func TestVnodeNotifySuccDead(t *testing.T) {
 	}
 }
 
+// Test notifying with no successor
+func TestVnodeNotifyNoSucc(t *testing.T) {
+	vn := makeVnode()
+	vn.init(0)
+	if err := vn.notifySuccessor(); err != errNoSuccessor {
+		t.Fatalf("unexpected err %v", err)
+	}
+
+	// No successor list at all
+	vn.successors = nil
+	if vn.successor() != nil {
+		t.Fatalf("unexpected successor")
+	}
+}
+
 func TestVnodeNotifySamePred(t *testing.T) {
 	r := makeRing()
 	sort.Sort(r)
@@ -355,7 +400,7 @@ func TestVnodeNotifySamePred(t *testing.T) {
 	vn2.successors[1] = s2
 	vn2.successors[2] = s3
 
-	succs, err := vn2.Notify(&vn1.Vnode)
+	succs, err := vn2.Notify(context.Background(), &vn1.Vnode)
 	if err != nil {
 		t.Fatalf("unexpected error! %s", err)
 	}
@@ -387,7 +432,7 @@ func TestVnodeNotifyNoPred(t *testing.T) {
 	vn2.successors[1] = s2
 	vn2.successors[2] = s3
 
-	succs, err := vn2.Notify(&vn1.Vnode)
+	succs, err := vn2.Notify(context.Background(), &vn1.Vnode)
 	if err != nil {
 		t.Fatalf("unexpected error! %s", err)
 	}
@@ -414,7 +459,7 @@ func TestVnodeNotifyNewPred(t *testing.T) {
 	vn3 := r.vnodes[2]
 	vn3.predecessor = &vn1.Vnode
 
-	_, err := vn3.Notify(&vn2.Vnode)
+	_, err := vn3.Notify(context.Background(), &vn2.Vnode)
 	if err != nil {
 		t.Fatalf("unexpected error! %s", err)
 	}
@@ -522,7 +567,7 @@ func TestVnodeFindSuccessors(t *testing.T) {
 	// Do a lookup on the key
 	for i := 0; i < len(r.vnodes); i++ {
 		vn := r.vnodes[i]
-		succ, err := vn.FindSuccessors(1, key)
+		succ, err := vn.FindSuccessors(context.Background(), 1, key)
 		if err != nil {
 			t.Fatalf("unexpected err! %s", err)
 		}
@@ -558,7 +603,7 @@ func TestVnodeFindSuccessorsMultSucc(t *testing.T) {
 	// Do a lookup on the key
 	for i := 0; i < len(r.vnodes); i++ {
 		vn := r.vnodes[i]
-		succ, err := vn.FindSuccessors(1, key)
+		succ, err := vn.FindSuccessors(context.Background(), 1, key)
 		if err != nil {
 			t.Fatalf("unexpected err! %s", err)
 		}
@@ -597,7 +642,7 @@ func TestVnodeFindSuccessorsSomeDead(t *testing.T) {
 	// Do a lookup on the key
 	for i := 0; i < len(r.vnodes); i++ {
 		vn := r.vnodes[i]
-		succ, err := vn.FindSuccessors(1, key)
+		succ, err := vn.FindSuccessors(context.Background(), 1, key)
 		if err != nil {
 			t.Fatalf("(%d) unexpected err! %s", i, err)
 		}
@@ -615,14 +660,14 @@ func TestVnodeClearPred(t *testing.T) {
 	v.init(0)
 	p := &Vnode{Id: []byte{12}}
 	v.predecessor = p
-	v.ClearPredecessor(p)
+	v.ClearPredecessor(context.Background(), p)
 	if v.predecessor != nil {
 		t.Fatalf("expect no predecessor!")
 	}
 
 	np := &Vnode{Id: []byte{14}}
 	v.predecessor = p
-	v.ClearPredecessor(np)
+	v.ClearPredecessor(context.Background(), np)
 	if v.predecessor != p {
 		t.Fatalf("expect p predecessor!")
 	}
@@ -641,7 +686,7 @@ func TestVnodeSkipSucc(t *testing.T) {
 	v.successors[2] = s3
 
 	// s2 should do nothing
-	if err := v.SkipSuccessor(s2); err != nil {
+	if err := v.SkipSuccessor(context.Background(), s2); err != nil {
 		t.Fatalf("unexpected err")
 	}
 	if v.successors[0] != s1 {
@@ -649,7 +694,7 @@ func TestVnodeSkipSucc(t *testing.T) {
 	}
 
 	// s1 should skip
-	if err := v.SkipSuccessor(s1); err != nil {
+	if err := v.SkipSuccessor(context.Background(), s1); err != nil {
 		t.Fatalf("unexpected err")
 	}
 	if v.successors[0] != s2 {
@@ -682,3 +727,109 @@ func TestVnodeLeave(t *testing.T) {
 		t.Fatalf("unexpected pred!")
 	}
 }
+
+// Hammers the RPC handlers while the vnodes stabilize.  Run with -race.
+func TestVnodeConcurrentRPC(t *testing.T) {
+	r := makeRing()
+	r.config.StabilizeMin = time.Millisecond
+	r.config.StabilizeMax = 3 * time.Millisecond
+	r.setLocalSuccessors()
+	r.schedule()
+
+	h := r.config.HashFunc()
+	h.Write([]byte("test"))
+	key := h.Sum(nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, vn := range r.vnodes {
+		wg.Add(1)
+		go func(vn *localVnode) {
+			defer wg.Done()
+			ctx := context.Background()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				other := &r.vnodes[i%len(r.vnodes)].Vnode
+				vn.Notify(ctx, other)
+				vn.FindSuccessors(ctx, 2, key)
+				vn.GetPredecessor(ctx)
+				if i%16 == 0 {
+					vn.ClearPredecessor(ctx, other)
+				}
+
+				// Snapshots must never have holes
+				succs := vn.successorList(false)
+				known := knownVnodes(succs)
+				for j := 0; j < known; j++ {
+					if succs[j] == nil {
+						t.Errorf("hole in successor list at %d: %v", j, succs)
+						return
+					}
+				}
+			}
+		}(vn)
+	}
+
+	<-time.After(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	r.stopVnodes()
+}
+
+func TestVnodeInfo(t *testing.T) {
+	r := makeRing()
+	sort.Sort(r)
+
+	vn1 := r.vnodes[0]
+	vn2 := r.vnodes[1]
+	vn3 := r.vnodes[2]
+	vn1.predecessor = &r.vnodes[4].Vnode
+	vn1.successors[0] = &vn2.Vnode
+	vn1.successors[1] = &vn3.Vnode
+	vn1.finger[0] = &vn2.Vnode
+	vn1.finger[1] = &vn2.Vnode
+	vn1.finger[2] = &vn2.Vnode
+	vn1.finger[3] = &vn3.Vnode
+	vn1.finger[5] = &vn3.Vnode
+	vn1.lastFinger = 6
+
+	info := vn1.info()
+	if !bytes.Equal(info.Vnode.Id, vn1.Id) || info.Vnode.Host != vn1.Host {
+		t.Fatalf("bad vnode")
+	}
+	if info.Predecessor.StringID() != r.vnodes[4].StringID() {
+		t.Fatalf("bad predecessor")
+	}
+	if len(info.Successors) != 2 || info.Successors[1].StringID() != vn3.StringID() {
+		t.Fatalf("bad successors: %v", info.Successors)
+	}
+	if info.LastFinger != 6 {
+		t.Fatalf("bad last finger")
+	}
+
+	exp := []FingerRange{
+		{Start: 0, End: 2, Vnode: &vn2.Vnode},
+		{Start: 3, End: 3, Vnode: &vn3.Vnode},
+		{Start: 5, End: 5, Vnode: &vn3.Vnode},
+	}
+	if len(info.Fingers) != len(exp) {
+		t.Fatalf("bad fingers: %v", info.Fingers)
+	}
+	for i, f := range info.Fingers {
+		if f.Start != exp[i].Start || f.End != exp[i].End ||
+			f.Vnode.StringID() != exp[i].Vnode.StringID() {
+			t.Fatalf("bad finger %d: %v", i, f)
+		}
+	}
+
+	// The snapshot must not alias the vnode state
+	info.Successors[0] = nil
+	if vn1.successors[0] != &vn2.Vnode {
+		t.Fatalf("snapshot aliases successors")
+	}
+}